@@ -0,0 +1,255 @@
+package gitage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age/armor"
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// cacheDirName is the name of the directory, within the .gitage
+// directory, that holds the blob cache (see blobCache), which is
+// local to each working copy, so it is ignored by Git.
+const cacheDirName = "cache"
+
+// cacheKeySize is the size, in bytes, of the key of the blob
+// cache, which is stored hex-encoded, like the hashes.
+const cacheKeySize = 32
+
+// blobCache keeps, for each file of the repository, the last ciphertext
+// it was encrypted to, or decrypted from, along with a keyed hash (HMAC)
+// of its plain contents and its format, and the fingerprint of the
+// recipients it is encrypted to, so a file whose plain contents did not
+// change is not encrypted again, but its ciphertext reused. Otherwise, as
+// age encryption is randomized, every file would look modified to Git
+// after every run.
+//
+// The key of the hash is random and local to each working copy, like the
+// cache itself, so the hashes tell nothing about the plain contents.
+//
+// The recipients of a decrypted file are the ones recorded in the manifest
+// for its ciphertext (see manifest), as age hides them, and the file is not
+// cached if there are none. A ciphertext is only reused for the recipients
+// it is encrypted to, so a file is encrypted again when either its plain
+// contents or its recipients change (e.g. after unregistering some).
+//
+// A nil cache (outside a repository) never holds anything.
+type blobCache struct {
+	f    billy.Filesystem
+	root string
+	dir  string
+	key  []byte
+}
+
+// openBlobCache opens the blob cache of the repository the given
+// configuration was loaded from, if any, which is created (along
+// with its key) the first time.
+func openBlobCache(f billy.Filesystem, cfg *Config) (*blobCache, error) {
+	if len(cfg.root) == 0 {
+		return nil, nil
+	}
+
+	c := &blobCache{
+		f:    f,
+		root: cfg.root,
+		dir:  filepath.Join(dir(cfg.root), cacheDirName),
+	}
+
+	keyPath := filepath.Join(c.dir, "key")
+
+	contents, err := fs.Read(f, keyPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != cacheKeySize {
+		key = make([]byte, cacheKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		// The cache is local, so it is never committed.
+		if err := fs.Create(f, filepath.Join(c.dir, ".gitignore"), []byte("*\n")); err != nil {
+			return nil, err
+		}
+
+		// Only readable by its owner, like identities (see GenerateIdentity).
+		if err := fs.WriteFile(f, keyPath, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	c.key = key
+
+	return c, nil
+}
+
+// name returns the name the cache knows the (plain)
+// file at the given path by, relative to the root.
+func (c *blobCache) name(path string) string {
+	if c == nil {
+		return ""
+	}
+
+	return relSlash(c.root, path)
+}
+
+// hash returns the keyed hash to write the plain contents of
+// the file with the given name into, either armored or not.
+//
+// It returns nil when there is nothing to cache (outside a repository).
+func (c *blobCache) hash(name string, armored bool) hash.Hash {
+	if c == nil || len(name) == 0 {
+		return nil
+	}
+
+	format := "binary"
+	if armored {
+		format = "armored"
+	}
+
+	h := hmac.New(sha256.New, c.key)
+	for _, s := range []string{name, format} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return h
+}
+
+// sum returns the keyed hash (see hash) of the plain
+// contents read from r, or nil if there is nothing to cache.
+func (c *blobCache) sum(name string, armored bool, r io.Reader) ([]byte, error) {
+	h := c.hash(name, armored)
+	if h == nil {
+		return nil, nil
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// sumFile is like sum, but it reads the plain contents from the file at the given path.
+func (c *blobCache) sumFile(path string, armored bool) ([]byte, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	file, err := c.f.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.sum(c.name(path), armored, file)
+}
+
+// entryPath returns the path of the entry of the file with the given name.
+func (c *blobCache) entryPath(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// reuse writes into dst the ciphertext cached for the file with the
+// given name, if any, and only if its plain contents and format (see
+// hash) are still the same, and it is encrypted to the recipients with
+// the given fingerprint. It reports whether it did.
+func (c *blobCache) reuse(dst io.Writer, name string, sum []byte, fingerprint string) (bool, error) {
+	if c == nil || sum == nil || len(fingerprint) == 0 {
+		return false, nil
+	}
+
+	entry, err := c.f.Open(c.entryPath(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+	defer entry.Close()
+
+	// The hash and the fingerprint go first,
+	// hex-encoded, in a line of their own.
+	line := make([]byte, 2*hex.EncodedLen(sha256.Size)+2)
+	if _, err := io.ReadFull(entry, line); err != nil {
+		return false, nil
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) != 2 || fields[1] != fingerprint {
+		return false, nil
+	}
+
+	cached, err := hex.DecodeString(fields[0])
+	if err != nil || !hmac.Equal(cached, sum) {
+		return false, nil
+	}
+
+	if _, err := io.Copy(dst, entry); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// store caches the ciphertext read from r for the file with the given
+// name, along with the keyed hash of its plain contents (see hash) and
+// the fingerprint of the recipients it is encrypted to, in place of the
+// previous one, if any. It does nothing if sum is nil, or if the
+// fingerprint is not known (empty), as the ciphertext could then be
+// reused for recipients it is not encrypted to.
+func (c *blobCache) store(name string, sum []byte, fingerprint string, r io.Reader) error {
+	if c == nil || sum == nil || len(fingerprint) == 0 {
+		return nil
+	}
+
+	entry, err := c.f.Create(c.entryPath(name))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, io.MultiReader(strings.NewReader(hex.EncodeToString(sum)+" "+fingerprint+"\n"), r))
+
+	if closeErr := entry.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// storeFile is like store, but it reads the ciphertext from the file at the given path.
+func (c *blobCache) storeFile(name string, sum []byte, fingerprint string, path string) error {
+	if c == nil || sum == nil || len(fingerprint) == 0 {
+		return nil
+	}
+
+	file, err := c.f.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.store(name, sum, fingerprint, file)
+}
+
+// isArmored reports whether the given
+// ciphertext is ASCII-armored.
+func isArmored(ciphertext []byte) bool {
+	return bytes.HasPrefix(ciphertext, []byte(armor.Header))
+}
@@ -0,0 +1,124 @@
+package gitage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Cat writes the plain contents of the encrypted file at the given
+// path into dst, decrypted with the given identities, as a stream,
+// without modifying the working tree, nor writing anything to disk.
+//
+// The path can be given by the name of either the encrypted file, or
+// the plain one (e.g. foo, for foo.age). It can also refer to a file
+// in the Git history, in the <rev>:<path> form (e.g. HEAD~1:foo.age),
+// like 'git show' does, with the path relative to the root of the
+// repository, in which case the file is read from the Git repository.
+func (r *Repository) Cat(ctx context.Context, dst io.Writer, path string, identities ...age.Identity) error {
+	var (
+		src io.ReadCloser
+		err error
+	)
+
+	if rev, name, ok := splitRevPath(path); ok {
+		src, err = r.openBlob(rev, name)
+	} else {
+		src, err = r.openFile(path)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return DecryptStream(ctx, dst, src, identities...)
+}
+
+// openFile opens the encrypted file at the given path,
+// within the working tree, given by either its name,
+// or the name of the plain file.
+func (r *Repository) openFile(path string) (io.ReadCloser, error) {
+	path, err := r.abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, r.cfg.Extension) {
+		if _, err := r.f.Stat(path + r.cfg.Extension); err == nil {
+			path += r.cfg.Extension
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if !strings.HasSuffix(path, r.cfg.Extension) {
+		return nil, fmt.Errorf("%s is not encrypted (no %s extension)", path, r.cfg.Extension)
+	}
+
+	return r.f.Open(path)
+}
+
+// openBlob opens the file at the given path, relative to the root,
+// as stored in the given revision of the Git repository, given by
+// either its name, or the name of the plain file.
+//
+// Unlike in the working tree, files can be stored encrypted under
+// the name of the plain file, by the filter driver (see Install).
+func (r *Repository) openBlob(rev, name string) (io.ReadCloser, error) {
+	name = path.Clean(filepath.ToSlash(name))
+	if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+		return nil, fmt.Errorf("%w: %s:%s", ErrOutsideRepository, rev, name)
+	}
+
+	repo, err := openGitRepository(r.f, r.root)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rev, err)
+	}
+
+	commit, err := repo.CommitObject(*h)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rev, err)
+	}
+
+	file, err := commit.File(name)
+	if errors.Is(err, object.ErrFileNotFound) && !strings.HasSuffix(name, r.cfg.Extension) {
+		file, err = commit.File(name + r.cfg.Extension)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %w", rev, name, err)
+	}
+
+	return file.Reader()
+}
+
+// splitRevPath splits the given path, in the <rev>:<path>
+// form, into the revision and the path, if it is in that form.
+func splitRevPath(p string) (string, string, bool) {
+	// e.g. C:\foo, on Windows
+	if filepath.IsAbs(p) {
+		return "", "", false
+	}
+
+	i := strings.Index(p, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	return p[:i], p[i+1:], true
+}
@@ -0,0 +1,239 @@
+package gitage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CheckStaged inspects the files staged (the Git index) in the
+// repository, and reports the ones that are meant to be encrypted,
+// according to the rules of the repository (see Rules), but whose
+// staged contents are not age-encrypted, as FilePlaintext, so they
+// can be prevented from being committed.
+//
+// Either the plain (e.g. foo) or the encrypted (e.g. foo.age) file can
+// be staged, as they are the same file, encrypted by EncryptAll or by
+// Git itself, through the filter driver (see Install).
+func (r *Repository) CheckStaged(ctx context.Context) ([]FileStatus, error) {
+	c, err := newChecker(r.f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := c.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []FileStatus
+
+	for _, e := range idx.Entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		exposed, err := c.exposed(e.Name, e.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if exposed {
+			statuses = append(statuses, FileStatus{Path: e.Name, State: FilePlaintext})
+		}
+	}
+
+	return statuses, nil
+}
+
+// CheckStaged inspects the files staged (the Git index) in the Gitage
+// repository that contains the given path, as Repository.CheckStaged does.
+//
+// Arguments:
+// - path: must be an absolute path.
+func CheckStaged(ctx context.Context, f billy.Filesystem, path string) ([]FileStatus, error) {
+	r, err := Open(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CheckStaged(ctx)
+}
+
+// CheckCommits inspects the files of the commits reachable from the
+// given revision (e.g. a branch about to be pushed), but not from the
+// given base one (e.g. the remote branch), if any, in the repository,
+// and reports the ones that are not age-encrypted, although they are
+// meant to be (see CheckStaged).
+//
+// Files are reported as FilePlaintext, with paths in the <commit>:<path>
+// form (with the abbreviated commit hash), so they can be inspected with
+// 'git show'.
+func (r *Repository) CheckCommits(ctx context.Context, rev, base string) ([]FileStatus, error) {
+	c, err := newChecker(r.f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := c.commit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits already in the base revision were already checked.
+	seen := make(map[plumbing.Hash]bool)
+	if len(base) > 0 {
+		baseCommit, err := c.commit(base)
+		switch {
+		// The base may not be known locally (e.g. someone else pushed),
+		// in which case all the commits reachable are checked instead.
+		case errors.Is(err, plumbing.ErrReferenceNotFound), errors.Is(err, plumbing.ErrObjectNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			err = object.NewCommitPreorderIter(baseCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+				seen[commit.Hash] = true
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var statuses []FileStatus
+
+	err = object.NewCommitPreorderIter(from, seen, nil).ForEach(func(commit *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		files, err := commit.Files()
+		if err != nil {
+			return err
+		}
+
+		return files.ForEach(func(file *object.File) error {
+			exposed, err := c.exposed(file.Name, file.Hash)
+			if err != nil {
+				return err
+			}
+
+			if exposed {
+				rev := commit.Hash.String()[:7]
+				statuses = append(statuses, FileStatus{Path: rev + ":" + file.Name, State: FilePlaintext})
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// CheckCommits inspects the files of the commits reachable from the
+// given revision, but not from the given base one, if any, in the
+// Gitage repository that contains the given path, as
+// Repository.CheckCommits does.
+//
+// Arguments:
+// - path: must be an absolute path.
+func CheckCommits(ctx context.Context, f billy.Filesystem, path, rev, base string) ([]FileStatus, error) {
+	r, err := Open(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CheckCommits(ctx, rev, base)
+}
+
+// checker checks whether the blobs stored in
+// a Git repository are encrypted when they must.
+type checker struct {
+	cfg   *Config
+	rules *Rules
+	repo  *git.Repository
+
+	// encrypted caches whether blobs are encrypted,
+	// as the same blob is usually found in many commits.
+	encrypted map[plumbing.Hash]bool
+}
+
+func newChecker(f billy.Filesystem, cfg *Config) (*checker, error) {
+	rules, err := loadRules(f, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := openGitRepository(f, cfg.root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &checker{cfg: cfg, rules: rules, repo: repo, encrypted: make(map[plumbing.Hash]bool)}, nil
+}
+
+func (c *checker) commit(rev string) (*object.Commit, error) {
+	h, err := c.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rev, err)
+	}
+
+	return c.repo.CommitObject(*h)
+}
+
+// exposed reports whether the blob stored at the given path (relative
+// to the root, and slash-separated) is meant to be encrypted, but it
+// is not.
+func (c *checker) exposed(name string, h plumbing.Hash) (bool, error) {
+	// Git and Gitage metadata are never encrypted.
+	if strings.HasPrefix(name, dirName+"/") || metadataFiles[path.Base(name)] {
+		return false, nil
+	}
+
+	plain := strings.TrimSuffix(name, c.cfg.Extension)
+	if !c.rules.Match(filepath.Join(c.cfg.root, filepath.FromSlash(plain))) {
+		return false, nil
+	}
+
+	encrypted, ok := c.encrypted[h]
+	if !ok {
+		blob, err := c.repo.BlobObject(h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// e.g. submodules
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		r, err := blob.Reader()
+		if err != nil {
+			return false, err
+		}
+
+		// Empty files hold no secrets.
+		encrypted = blob.Size == 0 || isEncrypted(bufio.NewReaderSize(r, headerSize))
+		if err := r.Close(); err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+
+		c.encrypted[h] = encrypted
+	}
+
+	return !encrypted, nil
+}
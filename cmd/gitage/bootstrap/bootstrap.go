@@ -2,19 +2,57 @@ package bootstrap
 
 import (
 	"context"
+	"errors"
 
 	"github.com/go-git/go-billy/v5"
 
+	"github.com/joanlopez/gitage"
 	"github.com/joanlopez/gitage/cmd/gitage/bootstrap/cli"
 	"github.com/joanlopez/gitage/internal/log"
 )
 
-func Run(ctx context.Context, fs billy.Filesystem, args ...string) {
+// exitCodes are the codes the process exits with for the errors
+// scripts may want to tell apart, while any other error exits with 1.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{err: gitage.ErrNotARepository, code: 2},
+	{err: gitage.ErrAlreadyInitialized, code: 3},
+	{err: gitage.ErrNoRecipients, code: 4},
+	{err: gitage.ErrNoMatchingIdentity, code: 5},
+	{err: gitage.ErrAlreadyEncrypted, code: 6},
+}
+
+// Run runs the CLI with the given args, and
+// returns the code the process must exit with.
+func Run(ctx context.Context, fs billy.Filesystem, args ...string) int {
 	// Then we initialize a CLI with the given fs and out
 	app := cli.New(ctx, fs)
 
 	// Finally we run the CLI
-	if err := app.Execute(args...); err != nil {
-		log.For(ctx).Printf("Error: %s\n", err)
+	err := app.Execute(args...)
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *cli.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	log.For(ctx).Printf("Error: %s\n", err)
+
+	return exitCode(err)
+}
+
+// exitCode returns the code the process must exit with for the given error.
+func exitCode(err error) int {
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
 	}
+
+	return 1
 }
@@ -5,65 +5,151 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"filippo.io/age"
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/joanlopez/gitage"
 	"github.com/joanlopez/gitage/cmd/gitage/bootstrap"
+	"github.com/joanlopez/gitage/cmd/gitage/bootstrap/cli"
 	"github.com/joanlopez/gitage/internal/fs/fstest"
 	"github.com/joanlopez/gitage/internal/log"
 )
 
+// passphrase is the one test cases encrypt and decrypt files with,
+// when asked to (--passphrase), through the environment.
+const passphrase = "correct horse battery staple"
+
 func Test(t *testing.T) {
 	t.Parallel()
 
 	tcs := []struct {
 		dir  string
 		args []string
+		code int
 	}{
 		// ~/$ gitage
 		{dir: "no-cmd-no-args", args: []string{}},
 
 		// ~/$ gitage init
 		{dir: "init-empty-repo", args: []string{"init", "-p", "/repo"}},
-		{dir: "init-existing-repo", args: []string{"init", "-p", "/repo"}},
-		{dir: "init-wrong-repo", args: []string{"init", "-p", "/repo"}},
+		{dir: "init-existing-repo", args: []string{"init", "-p", "/repo"}, code: 3},
+		{dir: "init-wrong-repo", args: []string{"init", "-p", "/repo"}, code: 1},
 		{dir: "init-repo-with-single-recipient", args: []string{"init", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
 		{dir: "init-repo-with-multiple-recipients", args: []string{"init", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg"}},
 
 		// ~/$ gitage register
-		{dir: "register-no-args", args: []string{"register"}},
-		{dir: "register-no-recipients", args: []string{"register", "-p", "/repo"}},
-		{dir: "register-empty-repo", args: []string{"register", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
+		{dir: "register-no-args", args: []string{"register"}, code: 1},
+		{dir: "register-no-recipients", args: []string{"register", "-p", "/repo"}, code: 1},
+		{dir: "register-empty-repo", args: []string{"register", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}, code: 2},
 		{dir: "register-first-recipient", args: []string{"register", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
 		{dir: "register-repeated-recipient", args: []string{"register", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
 		{dir: "register-single-recipient", args: []string{"register", "-p", "/repo", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg"}},
+		{dir: "register-ssh-recipient", args: []string{"register", "-p", "/repo", "-r", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJx88tdtsC9fYp5kYZaQxttSQUtZAImfetVoE5J7bHEb me@x"}},
+		{dir: "register-plugin-recipient", args: []string{"register", "-p", "/repo", "-r", "age1fake1hnhedl78mdzxs3llcxvahcfa0cqsmjj2g2klj6dqysmnjcj2ptqsf2dzcy"}},
+		{dir: "register-labeled-recipients", args: []string{"register", "-p", "/repo", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5", "--name", "Bob <bob@corp>"}},
+		{dir: "register-invalid-recipient", args: []string{"register", "-p", "/repo", "-r", "ssh-ed25519 invalid"}, code: 1},
+		{dir: "register-group", args: []string{"register", "-p", "/repo", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5", "--name", "Carol <carol@corp>", "--group", "ops"}},
+		{dir: "register-from-subdir", args: []string{"register", "-p", "/repo/services/api", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg"}},
 		{dir: "register-multiple-recipients", args: []string{"register", "-p", "/repo", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5"}},
 
 		// ~/$ gitage unregister
-		{dir: "unregister-no-args", args: []string{"unregister"}},
-		{dir: "unregister-no-recipients", args: []string{"unregister", "-p", "/repo"}},
-		{dir: "unregister-empty-repo", args: []string{"unregister", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
+		{dir: "unregister-no-args", args: []string{"unregister"}, code: 1},
+		{dir: "unregister-no-recipients", args: []string{"unregister", "-p", "/repo"}, code: 1},
+		{dir: "unregister-empty-repo", args: []string{"unregister", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}, code: 2},
 		{dir: "unregister-single-recipient", args: []string{"unregister", "-p", "/repo", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg"}},
 		{dir: "unregister-multiple-recipients", args: []string{"unregister", "-p", "/repo", "-r", "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5"}},
+		{dir: "unregister-by-name", args: []string{"unregister", "-p", "/repo", "--name", "alice", "--name", "carol", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5"}},
+		{dir: "unregister-rekey", args: []string{"unregister", "-p", "/repo", "--name", "bob", "--rekey"}},
 		{dir: "unregister-last-recipient", args: []string{"unregister", "-p", "/repo", "-r", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
 
+		// ~/$ gitage recipients
+		{dir: "recipients-list", args: []string{"recipients", "list", "-p", "/repo"}},
+		{dir: "recipients-list-json", args: []string{"recipients", "list", "-p", "/repo", "--json"}, code: 1},
+		{dir: "recipients-show", args: []string{"recipients", "show", "-p", "/repo", "bob"}},
+		{dir: "recipients-list-git-boundary", args: []string{"recipients", "list", "-p", "/repo/vendor/lib/src"}, code: 2},
+		{dir: "recipients-verify", args: []string{"recipients", "verify", "-p", "/repo"}},
+		{dir: "recipients-verify-problems", args: []string{"recipients", "verify", "-p", "/repo"}, code: 1},
+
 		// ~/$ gitage encrypt
-		{dir: "encrypt-no-recipients", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-no-recipients", args: []string{"encrypt", "-p", "/repo/data"}, code: 4},
+		{dir: "encrypt-outside-repo", args: []string{"encrypt", "-p", "/repo/data", "-r", "age1xkt49yr0y689x45qqrja6rgl0sne82gw5gt6mhhepa7xm7r6myfsd63983"}},
 		{dir: "encrypt-multiple-files", args: []string{"encrypt", "-p", "/repo/data", "-r", "age1xkt49yr0y689x45qqrja6rgl0sne82gw5gt6mhhepa7xm7r6myfsd63983"}},
+		{dir: "encrypt-registered-recipients", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-invalid-recipients", args: []string{"encrypt", "-p", "/repo/data"}, code: 1},
+		{dir: "encrypt-armored", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-malformed-config", args: []string{"encrypt", "-p", "/repo/data"}, code: 1},
+		{dir: "encrypt-with-rules", args: []string{"encrypt", "-p", "/repo"}},
+		{dir: "encrypt-repo-root", args: []string{"encrypt", "-p", "/repo"}},
+		{dir: "encrypt-gitfile", args: []string{"encrypt", "-p", "/repo"}},
+		{dir: "encrypt-interrupted", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-interrupted-locked", args: []string{"encrypt", "-p", "/repo/data"}, code: 1},
+		{dir: "encrypt-passphrase-with-recipients", args: []string{"encrypt", "-p", "/repo/data", "--passphrase"}, code: 1},
+		{dir: "encrypt-passphrase-with-group", args: []string{"encrypt", "-p", "/repo/data", "--passphrase"}, code: 1},
+		{dir: "encrypt-labeled-recipients", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-groups-with-recipient", args: []string{"encrypt", "-p", "/repo", "-r", "age1yhm4gctwfmrpz87tdslm550wrx6m79y9f2hdzt0lndjnehwj0ukqrjpyx5"}},
+		{dir: "encrypt-unchanged", args: []string{"encrypt", "-p", "/repo/data"}},
+		{dir: "encrypt-paths", args: []string{"encrypt", "-p", "/repo", "config/prod.env", "secrets/*.json"}},
+		{dir: "encrypt-paths-doublestar", args: []string{"encrypt", "-p", "/repo", "secrets/**/*.json"}},
+		{dir: "encrypt-paths-outside", args: []string{"encrypt", "-p", "/repo", "../other/prod.env"}, code: 1},
+		{dir: "encrypt-parallel", args: []string{"encrypt", "-p", "/repo/data", "-j", "4"}},
 
 		// ~/$ gitage decrypt
-		{dir: "decrypt-no-identities", args: []string{"decrypt", "-p", "/repo/data"}},
+		{dir: "decrypt-outside-repo", args: []string{"decrypt", "-p", "/repo", "-i", "/home/identities"}},
+		{dir: "decrypt-no-identities", args: []string{"decrypt", "-p", "/repo/data"}, code: 2},
 		{dir: "decrypt-multiple-files", args: []string{"decrypt", "-p", "/repo/data", "-i", "/repo/.gitage/identities"}},
+		{dir: "decrypt-configured-identities", args: []string{"decrypt", "-p", "/repo/data"}},
+		{dir: "decrypt-cache", args: []string{"decrypt", "-p", "/repo/data"}},
+		{dir: "decrypt-wrong-identity", args: []string{"decrypt", "-p", "/repo/data", "-i", "/home/other-identities"}, code: 5},
+		{dir: "decrypt-ssh-identity", args: []string{"decrypt", "-p", "/repo/data", "-i", "/home/.ssh/id_ed25519"}},
+		{dir: "decrypt-paths", args: []string{"decrypt", "-p", "/repo", "-i", "/home/identities", "config/prod.env", "secrets/*.json"}},
+		{dir: "decrypt-interrupted-committed", args: []string{"decrypt", "-p", "/repo/data", "-i", "/home/identities"}},
+
+		// ~/$ gitage rekey
+		{dir: "rekey-wrong-identity", args: []string{"rekey", "-p", "/repo", "-i", "/home/other-identities"}, code: 5},
+
+		// ~/$ gitage verify
+		{dir: "verify-ok", args: []string{"verify", "-p", "/repo"}},
+		{dir: "verify-no-identities", args: []string{"verify", "-p", "/repo"}},
+		{dir: "verify-problems", args: []string{"verify", "-p", "/repo"}, code: 1},
+
+		// ~/$ gitage cat
+		{dir: "cat-file", args: []string{"cat", "-p", "/repo", "-i", "/home/identities", "secrets/db.json"}},
+		{dir: "cat-not-encrypted", args: []string{"show", "-p", "/repo", "-i", "/home/identities", "secrets/api.json"}, code: 1},
+
+		// ~/$ gitage status
+		{dir: "status-with-rules", args: []string{"status", "-p", "/repo"}, code: 1},
+		{dir: "status-json", args: []string{"status", "-p", "/repo", "--json"}, code: 1},
+		{dir: "status-with-groups", args: []string{"status", "-p", "/repo"}, code: 1},
+		{dir: "status-all-encrypted", args: []string{"status", "-p", "/repo"}},
+
+		// ~/$ gitage install
+		{dir: "install-filter", args: []string{"install", "-p", "/repo"}},
+
+		// ~/$ gitage hooks
+		{dir: "hooks-install", args: []string{"hooks", "install", "-p", "/repo"}},
+		{dir: "hooks-install-existing", args: []string{"hooks", "install", "-p", "/repo"}, code: 1},
+		{dir: "hooks-install-force", args: []string{"hooks", "install", "-p", "/repo", "--force"}},
+
+		// ~/$ gitage keygen
+		{dir: "keygen-existing-file", args: []string{"keygen", "-p", "/repo", "-o", "/home/identities"}, code: 1},
+		{dir: "keygen-register-no-repo", args: []string{"keygen", "-p", "/repo", "-o", "/home/identities", "--register"}, code: 2},
 	}
 
 	for _, tc := range tcs {
@@ -73,17 +159,182 @@ func Test(t *testing.T) {
 			// Different test cases can be executed in parallel
 			t.Parallel()
 
-			// Create a new filesystem
+			runTestCase(t, tc.dir, tc.args, tc.code)
+		})
+	}
+}
+
+// TestWithEnv runs the test cases that need the environment set, either
+// the passphrase (--passphrase), or the fake plugin in the $PATH (see
+// installFakePlugin), which cannot run along with the other test cases,
+// as they run in parallel and the environment is shared.
+func TestWithEnv(t *testing.T) {
+	plugins := buildFakePlugin(t)
+
+	tcs := []struct {
+		dir        string
+		args       []string
+		code       int
+		passphrase bool
+		plugin     bool
+	}{
+		// ~/$ gitage encrypt
+		{dir: "encrypt-passphrase", args: []string{"encrypt", "-p", "/repo/data", "--passphrase"}, passphrase: true},
+		{dir: "encrypt-plugin-recipient", args: []string{"encrypt", "-p", "/repo/data"}, plugin: true},
+		{dir: "encrypt-with-groups", args: []string{"encrypt", "-p", "/repo"}, plugin: true},
+
+		// ~/$ gitage decrypt
+		{dir: "decrypt-passphrase", args: []string{"decrypt", "-p", "/repo/data", "--passphrase"}, passphrase: true},
+		{dir: "decrypt-plugin-identity", args: []string{"decrypt", "-p", "/repo/data", "-i", "/home/identities"}, plugin: true},
+
+		// ~/$ gitage rekey
+		{dir: "rekey-new-recipient", args: []string{"rekey", "-p", "/repo"}, plugin: true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+
+		t.Run(tc.dir, func(t *testing.T) {
+			if tc.passphrase {
+				t.Setenv("GITAGE_PASSPHRASE", passphrase)
+			}
+
+			if tc.plugin {
+				installFakePlugin(t, plugins)
+			}
+
+			runTestCase(t, tc.dir, tc.args, tc.code)
+		})
+	}
+}
+
+// runTestCase runs the CLI with the given args on the file system of
+// the given test case, and asserts the results are the expected ones.
+func runTestCase(t *testing.T, dir string, args []string, expectedCode int) {
+	t.Helper()
+
+	// Create a new filesystem
+	f := fsForTestCase(t, dir)
+
+	// Create a new buffer to capture the output
+	out := new(bytes.Buffer)
+	ctx := log.Ctx(out)
+
+	// Run the bootstrap
+	code := bootstrap.Run(ctx, f, args...)
+
+	// Assert the results
+	assert.Equal(t, expectedCode, code, "Exit code was not as expected")
+	ass := newAsserter(t, dir, f, out)
+	ass.assertOutput()
+	ass.assertFileTree(true)
+}
+
+// TestGitageDir runs a test case with the repository set by $GITAGE_DIR
+// and no path given, which cannot run along with the other test cases,
+// as they run in parallel and the environment is shared.
+func TestGitageDir(t *testing.T) {
+	t.Setenv(cli.DirEnv, fstest.Rootify("/repo/.gitage"))
+
+	const dir = "status-gitage-dir"
+
+	f := fsForTestCase(t, dir)
+	out := new(bytes.Buffer)
+
+	code := bootstrap.Run(log.Ctx(out), f, "status")
+
+	assert.Equal(t, 1, code, "Exit code was not as expected")
+	ass := newAsserter(t, dir, f, out)
+	ass.assertOutput()
+	ass.assertFileTree(true)
+}
+
+// TestCatRevision runs cat on a file of the Git history, which is
+// committed beforehand, as test cases are plain file trees, and then
+// changed in the working tree, so both versions differ.
+func TestCatRevision(t *testing.T) {
+	t.Parallel()
+
+	const dir = "cat-revision"
+
+	f := fsForTestCase(t, dir)
+	root := fstest.Rootify("/repo")
+	commitAll(t, f, root)
+
+	recipient, err := gitage.ParseRecipient("age1xkt49yr0y689x45qqrja6rgl0sne82gw5gt6mhhepa7xm7r6myfsd63983")
+	require.NoError(t, err)
+
+	ciphertext, err := gitage.Encrypt(context.Background(), []byte("{\"password\": \"new secret\"}\n"), recipient)
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(f, filepath.Join(root, "secrets", "db.json.age"), ciphertext, 0o644))
+
+	out := new(bytes.Buffer)
+
+	code := bootstrap.Run(log.Ctx(out), f, "cat", "-p", "/repo", "-i", "/home/identities", "HEAD:secrets/db.json")
+
+	assert.Equal(t, 0, code, "Exit code was not as expected")
+	ass := newAsserter(t, dir, f, out)
+	ass.assertOutput()
+	ass.assertFileTree(true)
+}
+
+// TestStatusFiltered runs status on a repository with the filter driver
+// installed, where files are staged (committed beforehand) either plain,
+// as before installing it, or encrypted, as the filter does, and then
+// changed in the working tree, or not staged at all, yet.
+func TestStatusFiltered(t *testing.T) {
+	t.Parallel()
+
+	const dir = "status-filtered"
+
+	f := fsForTestCase(t, dir)
+	root := fstest.Rootify("/repo")
+	commitAll(t, f, root)
+
+	require.NoError(t, util.WriteFile(f, filepath.Join(root, "secrets", "token.json"), []byte("{\"token\": \"secret\"}\n"), 0o644))
+	require.NoError(t, util.WriteFile(f, filepath.Join(root, "secrets", "new.json"), []byte("{\"key\": \"secret\"}\n"), 0o644))
+
+	out := new(bytes.Buffer)
+
+	code := bootstrap.Run(log.Ctx(out), f, "status", "-p", "/repo")
+
+	assert.Equal(t, 1, code, "Exit code was not as expected")
+	ass := newAsserter(t, dir, f, out)
+	ass.assertOutput()
+	ass.assertFileTree(true)
+}
+
+// TestHooksRun runs the Git hooks on files committed (and so staged)
+// beforehand, as test cases are plain file trees, with the commits
+// about to be pushed given through the standard input, as Git does,
+// so they cannot run along with the other test cases.
+func TestHooksRun(t *testing.T) {
+	tcs := []struct {
+		dir  string
+		hook string
+		code int
+	}{
+		{dir: "hooks-run-pre-commit", hook: gitage.HookPreCommit, code: 1},
+		{dir: "hooks-run-pre-commit-encrypted", hook: gitage.HookPreCommit},
+		{dir: "hooks-run-pre-push", hook: gitage.HookPrePush, code: 1},
+		{dir: "hooks-run-pre-push-encrypted", hook: gitage.HookPrePush},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+
+		t.Run(tc.dir, func(t *testing.T) {
 			f := fsForTestCase(t, tc.dir)
+			head := commitAll(t, f, fstest.Rootify("/repo"))
+
+			// <local ref> SP <local sha1> SP <remote ref> SP <remote sha1> LF
+			setStdin(t, fmt.Sprintf("refs/heads/main %s refs/heads/main %s\n", head, plumbing.ZeroHash))
 
-			// Create a new buffer to capture the output
 			out := new(bytes.Buffer)
-			ctx := log.Ctx(out)
 
-			// Run the bootstrap
-			bootstrap.Run(ctx, f, tc.args...)
+			code := bootstrap.Run(log.Ctx(out), f, "hooks", "run", tc.hook, "-p", "/repo")
 
-			// Assert the results
+			assert.Equal(t, tc.code, code, "Exit code was not as expected")
 			ass := newAsserter(t, tc.dir, f, out)
 			ass.assertOutput()
 			ass.assertFileTree(true)
@@ -91,6 +342,186 @@ func Test(t *testing.T) {
 	}
 }
 
+// TestKeygen runs keygen, which output and identity file
+// are random, so they are checked apart from test cases.
+func TestKeygen(t *testing.T) {
+	t.Parallel()
+
+	f := fsForTestCase(t, "keygen-new-file")
+	out := new(bytes.Buffer)
+
+	code := bootstrap.Run(log.Ctx(out), f, "keygen", "-p", "/home", "-o", "/home/identities")
+	require.Equal(t, 0, code, "Exit code was not as expected: %s", out)
+
+	recipient := assertIdentityFile(t, f, fstest.Rootify("/home/identities"))
+	assert.Contains(t, out.String(), "Public key: "+recipient+"\n")
+}
+
+// TestKeygenRegister runs keygen with --register, like TestKeygen.
+func TestKeygenRegister(t *testing.T) {
+	t.Parallel()
+
+	f := fsForTestCase(t, "keygen-register")
+	out := new(bytes.Buffer)
+
+	code := bootstrap.Run(log.Ctx(out), f, "keygen", "-p", "/repo", "-o", "/home/identities", "--register")
+	require.Equal(t, 0, code, "Exit code was not as expected: %s", out)
+
+	recipient := assertIdentityFile(t, f, fstest.Rootify("/home/identities"))
+
+	recipients, err := util.ReadFile(f, fstest.Rootify("/repo/.gitage/recipients"))
+	require.NoError(t, err)
+	assert.Equal(t, "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg # Bob\n"+recipient+"\n", string(recipients))
+}
+
+// assertIdentityFile asserts that the identity file at the given path
+// is only readable by its owner, and that it holds an identity, with
+// the header written by age-keygen, and returns its public key.
+func assertIdentityFile(t *testing.T, f billy.Filesystem, path string) string {
+	t.Helper()
+
+	info, err := f.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "Identity file mode was not as expected")
+
+	contents, err := util.ReadFile(f, path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	require.Len(t, lines, 3, "Identity file was not as expected: %s", contents)
+
+	created := strings.TrimPrefix(lines[0], "# created: ")
+	_, err = time.Parse(time.RFC3339, created)
+	assert.NoError(t, err, "Identity file header was not as expected: %s", lines[0])
+
+	identities, err := age.ParseIdentities(bytes.NewReader(contents))
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+
+	identity, ok := identities[0].(*age.X25519Identity)
+	require.True(t, ok, "Identity was not as expected: %T", identities[0])
+
+	recipient := identity.Recipient().String()
+	assert.Equal(t, "# public key: "+recipient, lines[1])
+
+	return recipient
+}
+
+// TestVerifyAfterUnregister runs verify after unregistering a recipient,
+// and decrypting and encrypting the files back, which are re-encrypted,
+// as their recipients changed, rather than keeping their ciphertext,
+// still encrypted to the unregistered recipient.
+func TestVerifyAfterUnregister(t *testing.T) {
+	t.Parallel()
+
+	const dir = "verify-after-unregister"
+
+	f := fsForTestCase(t, dir)
+	path := fstest.Rootify("/repo/data/db.env.age")
+
+	ciphertext, err := util.ReadFile(f, path)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	ctx := log.Ctx(out)
+
+	for _, args := range [][]string{
+		{"unregister", "-p", "/repo", "--name", "bob"},
+		{"decrypt", "-p", "/repo", "-i", "/home/identities"},
+		{"encrypt", "-p", "/repo"},
+	} {
+		require.Equal(t, 0, bootstrap.Run(ctx, f, args...), "Exit code was not as expected: %s", out)
+	}
+
+	reencrypted, err := util.ReadFile(f, path)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, reencrypted, "Ciphertext was reused")
+
+	code := bootstrap.Run(ctx, f, "verify", "-p", "/repo", "-i", "/home/identities")
+
+	assert.Equal(t, 0, code, "Exit code was not as expected")
+	ass := newAsserter(t, dir, f, out)
+	ass.assertOutput()
+	ass.assertFileTree(true)
+}
+
+// commitAll initializes a Git repository at the given root,
+// and commits all the files within it, and returns the commit.
+func commitAll(t *testing.T, f billy.Filesystem, root string) plumbing.Hash {
+	t.Helper()
+
+	wt, err := f.Chroot(root)
+	require.NoError(t, err)
+
+	dot, err := wt.Chroot(git.GitDirName)
+	require.NoError(t, err)
+
+	repo, err := git.Init(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), wt)
+	require.NoError(t, err)
+
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+
+	require.NoError(t, w.AddWithOptions(&git.AddOptions{All: true}))
+
+	h, err := w.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Gitage", Email: "gitage@example.com", When: time.Unix(0, 0)},
+	})
+	require.NoError(t, err)
+
+	return h
+}
+
+// setStdin sets the standard input to the given contents,
+// until the test finishes, so it cannot run in parallel.
+func setStdin(t *testing.T, contents string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "stdin")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	stdin, err := os.Open(path)
+	require.NoError(t, err)
+
+	prev := os.Stdin
+	os.Stdin = stdin
+
+	t.Cleanup(func() {
+		os.Stdin = prev
+		_ = stdin.Close()
+	})
+}
+
+// buildFakePlugin builds the fake age plugin (see testdata/age-plugin-fake),
+// which stands in for real ones (e.g. age-plugin-yubikey), into a new
+// directory, which it returns, so it can be put in the $PATH (see
+// installFakePlugin).
+func buildFakePlugin(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	bin := filepath.Join(dir, "age-plugin-fake")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+
+	out, err := exec.Command("go", "build", "-o", bin, "./testdata/age-plugin-fake").CombinedOutput()
+	require.NoError(t, err, "Failed to build the fake plugin: %s", out)
+
+	return dir
+}
+
+// installFakePlugin puts the fake age plugin, built into the given
+// directory (see buildFakePlugin), in the $PATH, where plugins are
+// looked up, until the test finishes, so it can use its recipients
+// (age1fake1...) and identities (AGE-PLUGIN-FAKE-1...).
+func installFakePlugin(t *testing.T, dir string) {
+	t.Helper()
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
 func fsForTestCase(t *testing.T, dirName string) billy.Filesystem {
 	t.Helper()
 
@@ -170,6 +601,8 @@ func newAsserter(t *testing.T, dir string, testFS billy.Filesystem, testOut *byt
 	}
 }
 
+var manifestSumRegexp = regexp.MustCompile(`(?m)^[0-9a-f]{64} `)
+
 func (a asserter) assertFileTree(skipDotGit bool) {
 	a.t.Helper()
 
@@ -194,6 +627,12 @@ func (a asserter) assertFileTree(skipDotGit bool) {
 			gotData = string(fstest.FileContents(a.testArchive, f))
 		}
 
+		// Ciphertexts are random, and so are their hashes,
+		// which expected manifests hold as an asterisk.
+		if filepath.Base(f.Name) == "manifest" {
+			gotData = manifestSumRegexp.ReplaceAllString(gotData, "* ")
+		}
+
 		assert.Equal(a.t, string(f.Data), gotData, "File content was not as expected: %s", f.Name)
 	}
 
@@ -227,18 +666,20 @@ func (a asserter) assertOutput() {
 func identitiesFromFile(t *testing.T, dir string) []age.Identity {
 	t.Helper()
 
+	// Files encrypted with a passphrase (see passphrase).
+	scrypt, err := age.NewScryptIdentity(passphrase)
+	require.NoError(t, err)
+
 	const identitiesFilePathFmt = "./testdata/%s/identities"
 	identitiesFilePath, err := filepath.Abs(fmt.Sprintf(identitiesFilePathFmt, dir))
 	require.NoError(t, err)
 
-	f, err := os.Open(identitiesFilePath)
-	if err != nil && os.IsNotExist(err) {
-		return nil
+	if _, err := os.Stat(identitiesFilePath); os.IsNotExist(err) {
+		return []age.Identity{scrypt}
 	}
-	require.NoError(t, err)
 
-	identities, err := age.ParseIdentities(f)
+	identities, err := gitage.ReadIdentities(osfs.New(""), identitiesFilePath, nil)
 	require.NoError(t, err)
 
-	return identities
+	return append(identities, scrypt)
 }
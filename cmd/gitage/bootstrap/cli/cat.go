@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) catCmd() *cobra.Command {
+	if c.cat == nil {
+		c.cat = c.command(
+			"cat <file | rev:path>",
+			"Prints the decrypted contents of an encrypted file",
+			`cat is for printing the decrypted contents of a single encrypted file, given by the name
+of either the encrypted file or the plain one, without modifying the working tree, nor
+writing anything to disk. Files in the Git history can be given as <rev>:<path> (e.g.
+HEAD~1:secrets/db.json), with the path relative to the repository root, like git show.
+
+If no identities file is specified (-i), the ones configured in the repository are used.`,
+		)
+
+		// Set aliases
+		c.cat.Aliases = []string{"show"}
+
+		// Set args
+		c.cat.Args = cobra.ExactArgs(1)
+
+		// Set flags
+		c.cat.Flags().StringVarP(&c.identitiesPath, "identities", "i", "", "path to the identities file")
+		c.passphraseFlags(c.cat)
+
+		// Set pre-run fn
+		c.cat.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if len(c.identitiesPath) == 0 {
+				return nil
+			}
+			return c.fixPath("identities path (-i)", &c.identitiesPath)
+		}
+
+		// Set run fn
+		c.cat.RunE = func(cmd *cobra.Command, args []string) error {
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			identities, err := c.decryptIdentities()
+			if err != nil {
+				return err
+			}
+
+			return repo.Cat(c.ctx, log.For(c.ctx), args[0], identities...)
+		}
+	}
+
+	return c.cat
+}
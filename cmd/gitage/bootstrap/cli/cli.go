@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/spf13/cobra"
 
+	"github.com/joanlopez/gitage"
 	"github.com/joanlopez/gitage/internal/log"
 )
 
@@ -20,18 +22,43 @@ type CLI struct {
 	// Flags
 	path           string
 	recipients     []string
+	override       bool
 	identitiesPath string
+	jobs           int
+	json           bool
+	force          bool
+	output         string
+	registerKey    bool
+	passphrase     bool
+	passphraseFd   int
+	label          string
+	names          []string
+	rekeyFiles     bool
+	group          string
+
+	// Repository
+	repoRoot string
+	repoErr  error
 
 	// Writer
 	writer log.Writer
 
 	// Commands
-	root       *cobra.Command
-	init       *cobra.Command
-	register   *cobra.Command
-	unregister *cobra.Command
-	encrypt    *cobra.Command
-	decrypt    *cobra.Command
+	root            *cobra.Command
+	init            *cobra.Command
+	register        *cobra.Command
+	unregister      *cobra.Command
+	encrypt         *cobra.Command
+	decrypt         *cobra.Command
+	status          *cobra.Command
+	filter          *cobra.Command
+	install         *cobra.Command
+	hooks           *cobra.Command
+	keygen          *cobra.Command
+	recipientsGroup *cobra.Command
+	rekey           *cobra.Command
+	verify          *cobra.Command
+	cat             *cobra.Command
 }
 
 func New(ctx context.Context, fs billy.Filesystem) *CLI {
@@ -51,6 +78,15 @@ func New(ctx context.Context, fs billy.Filesystem) *CLI {
 	c.rootCmd().AddCommand(c.unregisterCmd())
 	c.rootCmd().AddCommand(c.encryptCmd())
 	c.rootCmd().AddCommand(c.decryptCmd())
+	c.rootCmd().AddCommand(c.statusCmd())
+	c.rootCmd().AddCommand(c.filterCmd())
+	c.rootCmd().AddCommand(c.installCmd())
+	c.rootCmd().AddCommand(c.hooksCmd())
+	c.rootCmd().AddCommand(c.keygenCmd())
+	c.rootCmd().AddCommand(c.recipientsGroupCmd())
+	c.rootCmd().AddCommand(c.rekeyCmd())
+	c.rootCmd().AddCommand(c.verifyCmd())
+	c.rootCmd().AddCommand(c.catCmd())
 
 	return c
 }
@@ -60,7 +96,11 @@ func (c *CLI) Execute(args ...string) error {
 	return c.rootCmd().Execute()
 }
 
-var errCannotGetCWD = errors.New("unable to get current working directory")
+var (
+	errCannotGetCWD              = errors.New("unable to get current working directory")
+	errOverrideWithoutRecipients = errors.New("--override requires at least one recipient (-r)")
+	errNoRecipientsOrNames       = errors.New("at least one recipient (-r) or name (--name) is required")
+)
 
 func (c *CLI) fixPath(id string, path *string) error {
 	var err error
@@ -81,3 +121,95 @@ func (c *CLI) fixPath(id string, path *string) error {
 
 	return nil
 }
+
+// DirEnv is the environment variable that, when set, holds the
+// path of the .gitage directory of the repository to use, instead
+// of looking it up from the path (-p), like $GIT_DIR does for Git.
+const DirEnv = "GITAGE_DIR"
+
+// findRoot looks up the root of the Gitage repository that contains
+// the path (-p), if any (see gitage.FindRoot), or the one set by
+// $GITAGE_DIR (see DirEnv), which becomes the path when none was
+// given and the working directory is not within the repository.
+func (c *CLI) findRoot(pathGiven bool) error {
+	root, err := c.lookupRoot()
+	if errors.Is(err, gitage.ErrNotARepository) {
+		// Not every command needs a repository.
+		c.repoErr = err
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.repoRoot = root
+
+	if rel, err := filepath.Rel(root, c.path); !pathGiven && (err != nil || strings.HasPrefix(rel, "..")) {
+		c.path = root
+	}
+
+	return nil
+}
+
+// lookupRoot returns the root of the Gitage repository set by
+// $GITAGE_DIR, if set, or the one that contains the path (-p).
+func (c *CLI) lookupRoot() (string, error) {
+	gitageDir := os.Getenv(DirEnv)
+	if len(gitageDir) == 0 {
+		return gitage.FindRoot(c.fs, c.path)
+	}
+
+	if err := c.fixPath("$"+DirEnv, &gitageDir); err != nil {
+		return "", err
+	}
+
+	root, err := gitage.DirRoot(c.fs, gitageDir)
+	if err != nil {
+		return "", fmt.Errorf("$%s: %w", DirEnv, err)
+	}
+
+	return root, nil
+}
+
+// repoPath returns the root of the Gitage repository, if any, or the
+// path (-p) otherwise, for the lookups of the repository that contains
+// a path to find the same one (e.g. when it is set by $GITAGE_DIR).
+func (c *CLI) repoPath() string {
+	if c.repoErr != nil || len(c.repoRoot) == 0 {
+		return c.path
+	}
+
+	return c.repoRoot
+}
+
+// repository opens the Gitage repository that
+// contains the given path (-p), if any.
+func (c *CLI) repository() (*gitage.Repository, error) {
+	if c.repoErr != nil {
+		return nil, c.repoErr
+	}
+
+	return gitage.Open(c.fs, c.repoRoot)
+}
+
+// ExitError is returned by commands that have already reported
+// their outcome, but still need the process to exit with a
+// non-zero code (e.g. status, when it finds plaintext files).
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// exit returns an ExitError with the given code, and silences
+// the usage and the error for the given command, as the outcome
+// has already been reported.
+func (c *CLI) exit(cmd *cobra.Command, code int) error {
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	return &ExitError{Code: code}
+}
@@ -1,52 +1,73 @@
 package cli
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 
 	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
 	"github.com/spf13/cobra"
 
 	"github.com/joanlopez/gitage"
-	"github.com/joanlopez/gitage/internal/fs"
 	"github.com/joanlopez/gitage/internal/log"
+	"github.com/joanlopez/gitage/internal/term"
 )
 
 func (c *CLI) decryptCmd() *cobra.Command {
 	if c.decrypt == nil {
 		c.decrypt = c.command(
-			"decrypt",
+			"decrypt [file | dir | pattern]...",
 			"Decrypts files on the specified path",
-			"",
+			`decrypt is for decrypting files on the specified path or, if any is given, the files,
+directories and glob patterns (e.g. 'secrets/*.json' or 'secrets/**/*.json') given, relative to
+the repository root, by the names of either the encrypted files or the plain ones.
+If no identities file is specified (-i), the ones configured in the repository are used.
+
+Files encrypted with a passphrase can be decrypted with --passphrase, which is read from
+the terminal, from $GITAGE_PASSPHRASE or from a file descriptor (--passphrase-fd).`,
 		)
 
 		// Set args
-		c.decrypt.Args = cobra.ExactArgs(0)
+		c.decrypt.Args = cobra.ArbitraryArgs
 
 		// Set flags
 		c.decrypt.Flags().StringVarP(&c.identitiesPath, "identities", "i", "", "path to the identities file")
-		if err := c.decrypt.MarkFlagRequired("identities"); err != nil {
-			panic(err)
-		}
+		c.decrypt.Flags().IntVarP(&c.jobs, "jobs", "j", 0, "number of files to process in parallel (0, the default, means one per CPU)")
+		c.passphraseFlags(c.decrypt)
 
 		// Set pre-run fn
 		c.decrypt.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if len(c.identitiesPath) == 0 {
+				return nil
+			}
 			return c.fixPath("identities path (-i)", &c.identitiesPath)
 		}
 
 		// Set run fn
 		c.decrypt.RunE = func(cmd *cobra.Command, args []string) error {
-			rawIdentities, err := fs.Read(c.fs, c.identitiesPath)
+			identities, err := c.decryptIdentities()
 			if err != nil {
 				return err
 			}
 
-			identities, err := age.ParseIdentities(bytes.NewReader(rawIdentities))
-			if err != nil {
-				return err
-			}
+			ctx := gitage.WithJobs(c.ctx, c.jobs)
 
 			log.For(c.ctx).Println("Decrypting files...")
-			err = gitage.DecryptAll(c.ctx, c.fs, c.path, identities...)
+
+			repo, err := c.repository()
+			switch {
+			case errors.Is(err, gitage.ErrNotARepository) && len(args) == 0:
+				// Outside of a repository, files are decrypted
+				// with the identities given explicitly (-i).
+				err = gitage.DecryptAll(ctx, c.fs, c.path, identities...)
+			case err != nil:
+			case len(args) > 0:
+				err = repo.DecryptPaths(ctx, args, identities...)
+			default:
+				err = repo.DecryptAll(ctx, c.path, identities...)
+			}
 			if err != nil {
 				return err
 			}
@@ -59,3 +80,72 @@ func (c *CLI) decryptCmd() *cobra.Command {
 
 	return c.decrypt
 }
+
+// decryptIdentities returns the identities to decrypt files with,
+// which are the passphrase (--passphrase), or the ones read from the
+// given identities file (-i) or, if none is given, from the locations
+// configured in the repository.
+func (c *CLI) decryptIdentities() ([]age.Identity, error) {
+	if c.usePassphrase() {
+		passphrase, err := c.readPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+
+		identity, err := gitage.PassphraseIdentity(c.fs, c.repoPath(), passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Identity{identity}, nil
+	}
+
+	if len(c.identitiesPath) > 0 {
+		return readIdentities(c.fs, c.identitiesPath)
+	}
+
+	cfg, err := gitage.LoadConfig(c.fs, c.repoPath())
+	if err != nil {
+		return nil, fmt.Errorf("no identities specified (-i): %w", err)
+	}
+
+	identities, err := configuredIdentities(c.fs, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identities specified (-i) nor found at: %s", strings.Join(cfg.IdentityFiles(), ", "))
+	}
+
+	return identities, nil
+}
+
+// configuredIdentities returns the identities read from the locations
+// configured in the repository, skipping the ones that do not exist.
+func configuredIdentities(f billy.Filesystem, cfg *gitage.Config) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	for _, path := range cfg.IdentityFiles() {
+		read, err := readIdentities(f, path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, read...)
+	}
+
+	return identities, nil
+}
+
+func readIdentities(f billy.Filesystem, path string) ([]age.Identity, error) {
+	return gitage.ReadIdentities(f, path, promptPassphrase)
+}
+
+func promptPassphrase(name string) ([]byte, error) {
+	return term.ReadSecret(fmt.Sprintf("Enter passphrase for %s:", name))
+}
@@ -1,8 +1,8 @@
 package cli
 
 import (
-	"bytes"
-	"strings"
+	"errors"
+	"fmt"
 
 	"filippo.io/age"
 	"github.com/spf13/cobra"
@@ -14,30 +14,52 @@ import (
 func (c *CLI) encryptCmd() *cobra.Command {
 	if c.encrypt == nil {
 		c.encrypt = c.command(
-			"encrypt",
+			"encrypt [file | dir | pattern]...",
 			"Encrypts files on the specified path",
-			"",
+			`encrypt is for encrypting files on the specified path or, if any is given, the files,
+directories and glob patterns (e.g. 'secrets/*.json' or 'secrets/**/*.json') given, relative to
+the repository root.
+By default, files are encrypted to the recipients registered in the repository.
+Additional recipients can be specified with -r, which files are encrypted to besides the
+ones of their group, or used exclusively with --override.
+
+Alternatively, files can be encrypted with a passphrase (--passphrase), read from the
+terminal, from $GITAGE_PASSPHRASE or from a file descriptor (--passphrase-fd), as long
+as there are no other recipients.`,
 		)
 
 		// Set args
-		c.encrypt.Args = cobra.ExactArgs(0)
+		c.encrypt.Args = cobra.ArbitraryArgs
 
 		// Set flags
 		c.encrypt.Flags().StringArrayVarP(&c.recipients, "recipient", "r", nil, "recipients to encrypt the repository")
-		if err := c.encrypt.MarkFlagRequired("recipient"); err != nil {
-			panic(err)
-		}
+		c.encrypt.Flags().BoolVar(&c.override, "override", false, "use only the given recipients (-r), ignoring the registered ones")
+		c.encrypt.Flags().IntVarP(&c.jobs, "jobs", "j", 0, "number of files to process in parallel (0, the default, means one per CPU)")
+		c.passphraseFlags(c.encrypt)
 
 		// Set run fn
 		c.encrypt.RunE = func(cmd *cobra.Command, args []string) error {
-			rawRecipients := []byte(strings.Join(c.recipients, "\n"))
-			recipients, err := age.ParseRecipients(bytes.NewReader(rawRecipients))
+			recipients, additional, err := c.encryptRecipients()
 			if err != nil {
 				return err
 			}
 
+			ctx := gitage.WithRecipients(gitage.WithJobs(c.ctx, c.jobs), additional...)
+
 			log.For(c.ctx).Println("Encrypting files...")
-			err = gitage.EncryptAll(c.ctx, c.fs, c.path, recipients...)
+
+			repo, err := c.repository()
+			switch {
+			case errors.Is(err, gitage.ErrNotARepository) && len(args) == 0:
+				// Outside of a repository, files are encrypted
+				// to the recipients given explicitly (-r).
+				err = gitage.EncryptAll(ctx, c.fs, c.path, recipients...)
+			case err != nil:
+			case len(args) > 0:
+				err = repo.EncryptPaths(ctx, args, recipients...)
+			default:
+				err = repo.EncryptAll(ctx, c.path, recipients...)
+			}
 			if err != nil {
 				return err
 			}
@@ -50,3 +72,112 @@ func (c *CLI) encryptCmd() *cobra.Command {
 
 	return c.encrypt
 }
+
+// encryptRecipients returns the recipients to encrypt files to, which
+// are either the ones given explicitly (-r), with --override, or outside
+// of a repository, or the passphrase (--passphrase), which cannot be
+// combined with any other.
+//
+// Otherwise, it returns no recipients, so the ones registered in the
+// group of each file are loaded by the encryption functions, and the
+// ones given explicitly, if any, as additional ones (see
+// gitage.WithRecipients).
+func (c *CLI) encryptRecipients() ([]age.Recipient, []age.Recipient, error) {
+	if c.usePassphrase() {
+		recipients, err := c.passphraseRecipients()
+		return recipients, nil, err
+	}
+
+	if len(c.recipients) == 0 {
+		if c.override {
+			return nil, nil, errOverrideWithoutRecipients
+		}
+		return nil, nil, nil
+	}
+
+	recipients, err := parseRecipients(c.recipients)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.override || c.repoErr != nil {
+		return recipients, nil, nil
+	}
+
+	return nil, recipients, nil
+}
+
+// passphraseRecipients returns the passphrase recipient, as long as
+// there is no other recipient, neither given explicitly (-r) nor
+// registered in any group of the repository (unless --override is set).
+func (c *CLI) passphraseRecipients() ([]age.Recipient, error) {
+	if len(c.recipients) > 0 {
+		return nil, fmt.Errorf("%w (-r)", gitage.ErrScryptNotAlone)
+	}
+
+	if !c.override {
+		registered, err := c.registeredRecipients()
+		if err != nil {
+			return nil, err
+		}
+
+		if registered > 0 {
+			return nil, fmt.Errorf("%w, and %d are registered (use --override to ignore them)", gitage.ErrScryptNotAlone, registered)
+		}
+	}
+
+	passphrase, err := c.readPassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient, err := gitage.PassphraseRecipient(c.fs, c.repoPath(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return []age.Recipient{recipient}, nil
+}
+
+func parseRecipients(rs []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(rs))
+	for _, r := range rs {
+		recipient, err := gitage.ParseRecipient(r)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// registeredRecipients returns the number of recipients registered
+// in the repository, if any, in the default group and the rest of
+// groups, as files may belong to any of them (see gitage.Rules.Group).
+func (c *CLI) registeredRecipients() (int, error) {
+	repo, err := c.repository()
+	if errors.Is(err, gitage.ErrNotARepository) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	groups, err := repo.Groups()
+	if err != nil {
+		return 0, err
+	}
+
+	registered := 0
+	for _, group := range append([]string{""}, groups...) {
+		set, err := repo.Recipients(group)
+		if err != nil {
+			return 0, err
+		}
+		registered += len(set.Entries())
+	}
+
+	return registered, nil
+}
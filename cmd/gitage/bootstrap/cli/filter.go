@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"io"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/gitfilter"
+)
+
+func (c *CLI) filterCmd() *cobra.Command {
+	if c.filter == nil {
+		c.filter = c.command(
+			"filter",
+			"Acts as a Git filter driver (see install)",
+			`filter is for encrypting and decrypting files from Git, as a filter driver.
+It is not meant to be run by hand, but by Git, once set up with 'gitage install'.
+
+Files are decrypted with the identities file specified (-i) or, if none is specified,
+with the ones configured in the repository. Files that cannot be decrypted are left encrypted.`,
+		)
+
+		// Set args
+		c.filter.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.filter.PersistentFlags().StringVarP(&c.identitiesPath, "identities", "i", "", "path to the identities file")
+
+		// Set pre-run fn
+		c.filter.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+			if err := c.rootCmd().PersistentPreRunE(cmd, args); err != nil {
+				return err
+			}
+
+			if len(c.identitiesPath) == 0 {
+				return nil
+			}
+			return c.fixPath("identities path (-i)", &c.identitiesPath)
+		}
+
+		c.filter.AddCommand(c.filterSubCmd(gitfilter.Clean, "Encrypts a file read from the standard input, as a Git clean filter"))
+		c.filter.AddCommand(c.filterSubCmd(gitfilter.Smudge, "Decrypts a file read from the standard input, as a Git smudge filter"))
+		c.filter.AddCommand(c.filterProcessCmd())
+	}
+
+	return c.filter
+}
+
+func (c *CLI) filterSubCmd(command, short string) *cobra.Command {
+	cmd := c.command(command+" [file]", short, "")
+
+	// Set args: the name of the file, as given by Git (%f),
+	// which tells the group of recipients to encrypt it to.
+	cmd.Args = cobra.MaximumNArgs(1)
+
+	// The output is the filtered file,
+	// so it must not be mixed with usage.
+	cmd.SilenceUsage = true
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		flt, err := c.newFilter()
+		if err != nil {
+			return err
+		}
+
+		var name string
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		return c.filterOne(flt, command, name, cmd.OutOrStdout(), cmd.InOrStdin())
+	}
+
+	return cmd
+}
+
+func (c *CLI) filterProcessCmd() *cobra.Command {
+	cmd := c.command(
+		"process",
+		"Encrypts and decrypts files, as a long-running Git filter process",
+		`process is for encrypting and decrypting files, as a long-running Git filter process.
+It speaks the version 2 of Git's filter protocol through the standard input and output.`,
+	)
+
+	// Set args
+	cmd.Args = cobra.ExactArgs(0)
+
+	// The output is the filter protocol,
+	// so it must not be mixed with usage.
+	cmd.SilenceUsage = true
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		flt, err := c.newFilter()
+		if err != nil {
+			return err
+		}
+
+		return gitfilter.Serve(cmd.InOrStdin(), cmd.OutOrStdout(), func(command, pathname string, dst io.Writer, src io.Reader) error {
+			return c.filterOne(flt, command, pathname, dst, src)
+		})
+	}
+
+	return cmd
+}
+
+func (c *CLI) filterOne(flt *gitage.Filter, command, name string, dst io.Writer, src io.Reader) error {
+	if command == gitfilter.Clean {
+		return flt.Clean(c.ctx, name, dst, src)
+	}
+
+	return flt.Smudge(c.ctx, name, dst, src)
+}
+
+// newFilter returns a filter with the identities read from the given
+// identities file (-i) or, if none is given, from the locations configured
+// in the repository, if any. With no identities, files are left encrypted.
+func (c *CLI) newFilter() (*gitage.Filter, error) {
+	identities, err := c.optionalIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	return gitage.NewFilter(c.fs, c.repoPath(), identities...)
+}
+
+// optionalIdentities returns the identities read from the given identities
+// file (-i) or, if none is given, from the locations configured in the
+// repository, if any, which, unlike decryptIdentities, may be none.
+func (c *CLI) optionalIdentities() ([]age.Identity, error) {
+	if len(c.identitiesPath) > 0 {
+		return readIdentities(c.fs, c.identitiesPath)
+	}
+
+	cfg, err := gitage.LoadConfig(c.fs, c.repoPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return configuredIdentities(c.fs, cfg)
+}
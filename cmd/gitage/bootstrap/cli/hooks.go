@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) hooksCmd() *cobra.Command {
+	if c.hooks == nil {
+		c.hooks = c.command(
+			"hooks",
+			"Manages the Git hooks that block committing plaintext files",
+			`hooks is for managing the Git hooks that block committing and pushing files
+meant to be encrypted, according to the repository rules, that are not encrypted.`,
+		)
+
+		// Set args
+		c.hooks.Args = cobra.ExactArgs(0)
+
+		c.hooks.AddCommand(c.hooksInstallCmd())
+		c.hooks.AddCommand(c.hooksRunCmd())
+	}
+
+	return c.hooks
+}
+
+func (c *CLI) hooksInstallCmd() *cobra.Command {
+	cmd := c.command(
+		"install",
+		"Installs the pre-commit and pre-push Git hooks",
+		`install is for installing the pre-commit and pre-push Git hooks into the Git repository.
+Existing hooks are not overwritten, unless they were installed by Gitage or --force is used.`,
+	)
+
+	// Set args
+	cmd.Args = cobra.ExactArgs(0)
+
+	// Set flags
+	cmd.Flags().BoolVar(&c.force, "force", false, "overwrite existing hooks")
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		repo, err := c.repository()
+		if err != nil {
+			return err
+		}
+
+		log.For(c.ctx).Printf("Installing Git hooks in %s...\n", repo.Root())
+
+		if err := repo.InstallHooks(c.ctx, c.force); err != nil {
+			return err
+		}
+
+		log.For(c.ctx).Println("Git hooks installed with success!")
+
+		return nil
+	}
+
+	return cmd
+}
+
+func (c *CLI) hooksRunCmd() *cobra.Command {
+	cmd := c.command(
+		"run <hook> [args...]",
+		"Runs a Git hook (pre-commit or pre-push)",
+		`run is for running a Git hook (pre-commit or pre-push), as Git does.
+It is not meant to be run by hand, but by the hooks installed with 'gitage hooks install'.`,
+	)
+
+	// Set args
+	cmd.Args = cobra.MinimumNArgs(1)
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		repo, err := c.repository()
+		if err != nil {
+			return err
+		}
+
+		var statuses []gitage.FileStatus
+
+		switch args[0] {
+		case gitage.HookPreCommit:
+			statuses, err = repo.CheckStaged(c.ctx)
+		case gitage.HookPrePush:
+			statuses, err = c.checkPush(cmd, repo)
+		default:
+			return fmt.Errorf("unknown hook %q (expected %s or %s)", args[0], gitage.HookPreCommit, gitage.HookPrePush)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(statuses) == 0 {
+			return nil
+		}
+
+		log.For(c.ctx).Println("Files meant to be encrypted found in plaintext:")
+		for _, s := range statuses {
+			log.For(c.ctx).Printf("  %s\n", s.Path)
+		}
+		log.For(c.ctx).Println("Encrypt them (see 'gitage encrypt') and try again.")
+
+		return c.exit(cmd, 1)
+	}
+
+	return cmd
+}
+
+// zeroHash is the hash Git uses for refs that do not exist.
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// checkPush checks the commits about to be pushed, as described by the
+// lines Git writes to the standard input of the pre-push hook:
+//
+//	<local ref> SP <local sha1> SP <remote ref> SP <remote sha1> LF
+func (c *CLI) checkPush(cmd *cobra.Command, repo *gitage.Repository) ([]gitage.FileStatus, error) {
+	var statuses []gitage.FileStatus
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+
+		local, remote := fields[1], fields[3]
+
+		// Deleted refs push no commits.
+		if local == zeroHash {
+			continue
+		}
+
+		// New refs have no base.
+		if remote == zeroHash {
+			remote = ""
+		}
+
+		found, err := repo.CheckCommits(c.ctx, local, remote)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, found...)
+	}
+
+	return statuses, scanner.Err()
+}
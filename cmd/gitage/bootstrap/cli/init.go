@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
 )
 
 func (c *CLI) initCmd() *cobra.Command {
@@ -23,7 +24,15 @@ It creates the .gitage directory with the subsequent files.`,
 
 		// Set run fn
 		c.init.RunE = func(cmd *cobra.Command, args []string) error {
-			return gitage.Init(c.ctx, c.fs, c.path, c.recipients...)
+			log.For(c.ctx).Printf("Initializing Gitage repository at %s...\n", c.path)
+
+			if _, err := gitage.InitRepository(c.ctx, c.fs, c.path, c.recipients...); err != nil {
+				return err
+			}
+
+			log.For(c.ctx).Println("Gitage repository initialized with success!")
+
+			return nil
 		}
 	}
 
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) installCmd() *cobra.Command {
+	if c.install == nil {
+		c.install = c.command(
+			"install",
+			"Sets up Git to encrypt files on commit and decrypt them on checkout",
+			`install is for setting up Git to encrypt files through a filter driver ('gitage filter').
+So, the files meant to be encrypted, according to the repository rules, are stored encrypted
+in Git, while they are kept as plain files in the working tree.
+
+It writes the filter attributes into .gitattributes, and the filter driver into .git/config.
+Run it again whenever the repository rules change.`,
+		)
+
+		// Set args
+		c.install.Args = cobra.ExactArgs(0)
+
+		// Set run fn
+		c.install.RunE = func(cmd *cobra.Command, args []string) error {
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			log.For(c.ctx).Printf("Installing the %q filter driver in %s...\n", gitage.FilterDriver, repo.Root())
+
+			if err := repo.Install(c.ctx); err != nil {
+				return err
+			}
+
+			log.For(c.ctx).Println("Gitage filter installed with success!")
+
+			return nil
+		}
+	}
+
+	return c.install
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+var errNoIdentitiesLocation = errors.New("no output file specified (-o) nor identities location configured")
+
+func (c *CLI) keygenCmd() *cobra.Command {
+	if c.keygen == nil {
+		c.keygen = c.command(
+			"keygen",
+			"Generates a new identity",
+			`keygen is for generating a new identity (a key pair), and writing it into a new file.
+If no output file is specified (-o), it is written to the first identities location configured
+in the repository, where decrypt looks for it (~/.config/gitage/identities by default).
+
+Its public key (the recipient) is printed, and it can be registered in the repository (--register).`,
+		)
+
+		// Set args
+		c.keygen.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.keygen.Flags().StringVarP(&c.output, "output", "o", "", "path to the identity file to write")
+		c.keygen.Flags().BoolVar(&c.registerKey, "register", false, "register the public key in the repository")
+
+		// Set pre-run fn
+		c.keygen.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if len(c.output) == 0 {
+				return nil
+			}
+			return c.fixPath("output file (-o)", &c.output)
+		}
+
+		// Set run fn
+		c.keygen.RunE = func(cmd *cobra.Command, args []string) error {
+			// The repository is looked up first, so no identity
+			// is written if the key cannot be registered.
+			var repo *gitage.Repository
+			if c.registerKey {
+				var err error
+				if repo, err = c.repository(); err != nil {
+					return err
+				}
+			}
+
+			if len(c.output) == 0 {
+				cfg, err := gitage.LoadConfig(c.fs, c.repoPath())
+				if err != nil {
+					return err
+				}
+
+				paths := cfg.IdentityFiles()
+				if len(paths) == 0 {
+					return errNoIdentitiesLocation
+				}
+				c.output = paths[0]
+			}
+
+			identity, err := gitage.GenerateIdentity(c.fs, c.output)
+			if err != nil {
+				return err
+			}
+
+			log.For(c.ctx).Printf("Identity written to %s\n", c.output)
+			log.For(c.ctx).Printf("Public key: %s\n", identity.Recipient())
+
+			if repo == nil {
+				return nil
+			}
+
+			log.For(c.ctx).Println("Registering recipients...")
+
+			if err := repo.Register(c.ctx, identity.Recipient().String()); err != nil {
+				return err
+			}
+
+			log.For(c.ctx).Println("Recipients registered with success!")
+
+			return nil
+		}
+	}
+
+	return c.keygen
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage/internal/term"
+)
+
+// passphraseEnv is the environment variable the passphrase
+// is read from, when no file descriptor is given, which is
+// meant for non-interactive environments (e.g. CI).
+const passphraseEnv = "GITAGE_PASSPHRASE"
+
+var (
+	errEmptyPassphrase      = errors.New("empty passphrase")
+	errPassphrasesDontMatch = errors.New("passphrases didn't match")
+)
+
+// passphraseFlags adds the flags to encrypt or decrypt files with a passphrase.
+func (c *CLI) passphraseFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.passphrase, "passphrase", false, "use a passphrase, read from $"+passphraseEnv+" or the terminal")
+	cmd.Flags().IntVar(&c.passphraseFd, "passphrase-fd", -1, "read the passphrase from the given file descriptor (implies --passphrase)")
+}
+
+// usePassphrase reports whether files are encrypted or
+// decrypted with a passphrase (--passphrase[-fd]).
+func (c *CLI) usePassphrase() bool {
+	return c.passphrase || c.passphraseFd >= 0
+}
+
+// readPassphrase reads the passphrase from the given file descriptor
+// (--passphrase-fd), the environment ($GITAGE_PASSPHRASE) or, if none,
+// the terminal, asking for it twice when confirm is true.
+func (c *CLI) readPassphrase(confirm bool) (string, error) {
+	if c.passphraseFd >= 0 {
+		return readPassphraseFd(c.passphraseFd)
+	}
+
+	if p, ok := os.LookupEnv(passphraseEnv); ok {
+		if len(p) == 0 {
+			return "", fmt.Errorf("%w ($%s)", errEmptyPassphrase, passphraseEnv)
+		}
+		return p, nil
+	}
+
+	p, err := term.ReadSecret("Enter passphrase:")
+	if err != nil {
+		return "", fmt.Errorf("cannot read passphrase: %w", err)
+	}
+
+	if len(p) == 0 {
+		return "", errEmptyPassphrase
+	}
+
+	if confirm {
+		again, err := term.ReadSecret("Confirm passphrase:")
+		if err != nil {
+			return "", fmt.Errorf("cannot read passphrase: %w", err)
+		}
+
+		if !bytes.Equal(p, again) {
+			return "", errPassphrasesDontMatch
+		}
+	}
+
+	return string(p), nil
+}
+
+// readPassphraseFd reads the first line of the given file descriptor.
+func readPassphraseFd(fd int) (string, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return "", fmt.Errorf("invalid passphrase file descriptor (--passphrase-fd): %d", fd)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", fmt.Errorf("cannot read passphrase from fd %d: %w", fd, err)
+		}
+		return "", fmt.Errorf("%w (fd %d)", errEmptyPassphrase, fd)
+	}
+
+	if len(scanner.Text()) == 0 {
+		return "", fmt.Errorf("%w (fd %d)", errEmptyPassphrase, fd)
+	}
+
+	return scanner.Text(), nil
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) recipientsGroupCmd() *cobra.Command {
+	if c.recipientsGroup == nil {
+		c.recipientsGroup = c.command(
+			"recipients",
+			"Lists, shows and verifies the recipients of the repository",
+			`recipients is for listing, showing and verifying the recipients registered
+in the repository, who can decrypt its files (see register and unregister).`,
+		)
+
+		// Set args
+		c.recipientsGroup.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.recipientsGroup.PersistentFlags().StringVar(&c.group, "group", "", "group of recipients (e.g. ops), instead of the default one")
+
+		c.recipientsGroup.AddCommand(c.recipientsListCmd())
+		c.recipientsGroup.AddCommand(c.recipientsShowCmd())
+		c.recipientsGroup.AddCommand(c.recipientsVerifyCmd())
+	}
+
+	return c.recipientsGroup
+}
+
+func (c *CLI) recipientsListCmd() *cobra.Command {
+	cmd := c.command(
+		"list",
+		"Lists the recipients of the repository",
+		`list is for listing the recipients registered in the repository, with their labels,
+key types and fingerprints, as well as the problems found in them, if any.
+
+It exits with a non-zero code if any problem is found (see verify).`,
+	)
+
+	// Set args
+	cmd.Args = cobra.ExactArgs(0)
+
+	// Set flags
+	cmd.Flags().BoolVar(&c.json, "json", false, "print the recipients in JSON format")
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		infos, err := c.inspectRecipients()
+		if err != nil {
+			return err
+		}
+
+		if c.json {
+			err = c.printRecipientsJSON(infos)
+		} else {
+			c.printRecipients(infos)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if countProblems(infos) > 0 {
+			return c.exit(cmd, 1)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+func (c *CLI) recipientsShowCmd() *cobra.Command {
+	cmd := c.command(
+		"show <recipient>",
+		"Shows the details of a recipient of the repository",
+		`show is for showing the details of the recipients registered in the repository
+that match the given one, either by key or by label, name or email (e.g. alice).`,
+	)
+
+	// Set args
+	cmd.Args = cobra.ExactArgs(1)
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		infos, err := c.inspectRecipients()
+		if err != nil {
+			return err
+		}
+
+		found := 0
+		for _, info := range infos {
+			if !info.Matches(args[0]) {
+				continue
+			}
+
+			if found > 0 {
+				log.For(c.ctx).Println()
+			}
+			found++
+
+			c.printRecipient(info)
+		}
+
+		if found == 0 {
+			return fmt.Errorf("no recipient matches %q", args[0])
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+func (c *CLI) recipientsVerifyCmd() *cobra.Command {
+	cmd := c.command(
+		"verify",
+		"Verifies the recipients of the repository",
+		`verify is for checking the recipients registered in the repository for problems:
+keys that cannot be parsed, duplicates, and the same key registered under two labels.
+
+It exits with a non-zero code if any problem is found, so it can be used in CI.`,
+	)
+
+	// Set args
+	cmd.Args = cobra.ExactArgs(0)
+
+	// Set run fn
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		infos, err := c.inspectRecipients()
+		if err != nil {
+			return err
+		}
+
+		if countProblems(infos) > 0 {
+			c.printRecipientProblems(infos)
+			return c.exit(cmd, 1)
+		}
+
+		log.For(c.ctx).Printf("%d recipient(s) verified, no problems found.\n", len(infos))
+
+		return nil
+	}
+
+	return cmd
+}
+
+func (c *CLI) inspectRecipients() ([]gitage.RecipientInfo, error) {
+	repo, err := c.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := repo.Recipients(c.group)
+	if err != nil {
+		return nil, err
+	}
+
+	return set.Inspect(), nil
+}
+
+func (c *CLI) printRecipients(infos []gitage.RecipientInfo) {
+	if len(infos) == 0 {
+		log.For(c.ctx).Println("No recipients registered.")
+		return
+	}
+
+	w := tabwriter.NewWriter(log.For(c.ctx), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "LABEL\tTYPE\tFINGERPRINT")
+	for _, info := range infos {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", labelOrDash(info.Label), info.Type, info.Fingerprint)
+	}
+	_ = w.Flush()
+
+	if countProblems(infos) > 0 {
+		log.For(c.ctx).Println()
+		c.printRecipientProblems(infos)
+	}
+}
+
+func (c *CLI) printRecipient(info gitage.RecipientInfo) {
+	log.For(c.ctx).Printf("Key:         %s\n", info.Key)
+	log.For(c.ctx).Printf("Label:       %s\n", labelOrDash(info.Label))
+	log.For(c.ctx).Printf("Type:        %s\n", info.Type)
+	log.For(c.ctx).Printf("Fingerprint: %s\n", info.Fingerprint)
+	log.For(c.ctx).Printf("Line:        %d\n", info.Line)
+
+	for _, problem := range info.Problems {
+		log.For(c.ctx).Printf("Problem:     %s\n", problem)
+	}
+}
+
+func (c *CLI) printRecipientProblems(infos []gitage.RecipientInfo) {
+	log.For(c.ctx).Printf("%d problem(s) found in the recipients:\n", countProblems(infos))
+
+	for _, info := range infos {
+		for _, problem := range info.Problems {
+			log.For(c.ctx).Printf("  line %d (%s): %s\n", info.Line, labelOrDash(info.Label), problem)
+		}
+	}
+}
+
+func (c *CLI) printRecipientsJSON(infos []gitage.RecipientInfo) error {
+	// Always an array, even if empty.
+	if infos == nil {
+		infos = []gitage.RecipientInfo{}
+	}
+
+	// Labels usually hold email addresses (e.g. <alice@corp>),
+	// which are kept as is, rather than escaped as HTML.
+	enc := json.NewEncoder(log.For(c.ctx))
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(infos); err != nil {
+		return fmt.Errorf("cannot encode recipients: %w", err)
+	}
+
+	return nil
+}
+
+func countProblems(infos []gitage.RecipientInfo) int {
+	n := 0
+	for _, info := range infos {
+		n += len(info.Problems)
+	}
+
+	return n
+}
+
+func labelOrDash(label string) string {
+	if len(label) == 0 {
+		return "-"
+	}
+
+	return label
+}
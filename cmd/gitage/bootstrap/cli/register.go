@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 
 	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
 )
 
 func (c *CLI) registerCmd() *cobra.Command {
@@ -19,15 +22,60 @@ func (c *CLI) registerCmd() *cobra.Command {
 
 		// Set flags
 		c.register.Flags().StringArrayVarP(&c.recipients, "recipient", "r", nil, "recipients to encrypt the repository")
+		c.register.Flags().StringVar(&c.label, "name", "", "label of the recipients (e.g. \"Alice <alice@corp>\")")
+		c.register.Flags().StringVar(&c.group, "group", "", "group of recipients to register them in (e.g. ops)")
+		c.rekeyFlag(c.register)
 		if err := c.register.MarkFlagRequired("recipient"); err != nil {
 			panic(err)
 		}
 
 		// Set run fn
 		c.register.RunE = func(cmd *cobra.Command, args []string) error {
-			return gitage.Register(c.ctx, c.fs, c.path, c.recipients...)
+			recipients, err := c.labeledRecipients()
+			if err != nil {
+				return err
+			}
+
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			return c.withRekey(func() error {
+				log.For(c.ctx).Println("Registering recipients...")
+
+				if err := repo.RegisterGroup(c.ctx, c.group, recipients...); err != nil {
+					return err
+				}
+
+				log.For(c.ctx).Println("Recipients registered with success!")
+
+				return nil
+			})
 		}
 	}
 
 	return c.register
 }
+
+// labeledRecipients returns the recipients given (-r), as entries
+// of the recipients file, labeled with the name given (--name),
+// if any, which replaces the label given along with them.
+func (c *CLI) labeledRecipients() ([]string, error) {
+	if len(c.label) == 0 {
+		return c.recipients, nil
+	}
+
+	recipients := make([]string, 0, len(c.recipients))
+	for _, r := range c.recipients {
+		entry, err := gitage.ParseRecipientEntry(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+
+		entry.Label = c.label
+		recipients = append(recipients, entry.String())
+	}
+
+	return recipients, nil
+}
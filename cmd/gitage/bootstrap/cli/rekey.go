@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) rekeyCmd() *cobra.Command {
+	if c.rekey == nil {
+		c.rekey = c.command(
+			"rekey",
+			"Re-encrypts files to the recipients of the repository",
+			`rekey is for re-encrypting the encrypted files on the specified path to the recipients
+currently registered in the repository, so the ones unregistered can no longer decrypt them,
+and the ones registered can. It can also be done on register and unregister (--rekey).
+
+Files are decrypted with the identities file specified (-i) or, if none is specified,
+with the ones configured in the repository. Plain contents are never written to disk.`,
+		)
+
+		// Set args
+		c.rekey.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.rekey.Flags().StringVarP(&c.identitiesPath, "identities", "i", "", "path to the identities file")
+		c.rekey.Flags().IntVarP(&c.jobs, "jobs", "j", 0, "number of files to process in parallel (0, the default, means one per CPU)")
+
+		// Set pre-run fn
+		c.rekey.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if len(c.identitiesPath) == 0 {
+				return nil
+			}
+			return c.fixPath("identities path (-i)", &c.identitiesPath)
+		}
+
+		// Set run fn
+		c.rekey.RunE = func(cmd *cobra.Command, args []string) error {
+			rekey, err := c.rekeyFn()
+			if err != nil {
+				return err
+			}
+
+			return rekey()
+		}
+	}
+
+	return c.rekey
+}
+
+// rekeyFn returns the function that re-encrypts the files on the
+// path to the registered recipients, and reports the ones touched.
+//
+// The identities to decrypt files with are read beforehand, so
+// commands that change the recipients (e.g. unregister --rekey)
+// fail before doing so, if there are none.
+func (c *CLI) rekeyFn() (func() error, error) {
+	repo, err := c.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := c.decryptIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		log.For(c.ctx).Println("Re-keying files...")
+
+		paths, err := repo.RekeyAll(gitage.WithJobs(c.ctx, c.jobs), c.path, identities...)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			log.For(c.ctx).Printf("  %s\n", path)
+		}
+
+		log.For(c.ctx).Printf("%d file(s) re-keyed with success!\n", len(paths))
+
+		return nil
+	}, nil
+}
+
+// rekeyFlag adds the --rekey flag to the given command,
+// which changes the recipients of the repository.
+func (c *CLI) rekeyFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.rekeyFiles, "rekey", false, "re-encrypt the files to the registered recipients afterwards (see rekey)")
+}
+
+// withRekey runs the given function, which changes the recipients
+// of the repository, and then re-encrypts the files to them, if
+// asked to (--rekey).
+func (c *CLI) withRekey(fn func() error) error {
+	if !c.rekeyFiles {
+		return fn()
+	}
+
+	rekey, err := c.rekeyFn()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return rekey()
+}
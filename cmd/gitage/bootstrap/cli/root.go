@@ -11,18 +11,35 @@ func (c *CLI) rootCmd() *cobra.Command {
 			"gitage",
 			"Git+age = Gitage; simple, modern and secure Git encryption tool",
 			`Gitage is a CLI tool that can be used as a wrapper of Git CLI.
-It uses 'age' encryption tool to encrypt files before committing them to the repository.`,
+It uses 'age' encryption tool to encrypt files before committing them to the repository.
+
+It exits with a non-zero code on failure, which tells apart the most common ones:
+  2  not a Gitage repository
+  3  Gitage repository already initialized
+  4  no recipients specified nor registered
+  5  no identity matched any of the recipients
+  6  file already encrypted`,
 		)
 
 		// Set version
 		c.root.Version = "v0.1.0"
 
+		// Errors are reported by the caller (see bootstrap.Run),
+		// and the usage is only printed when asked for (--help).
+		c.root.SilenceUsage = true
+		c.root.SilenceErrors = true
+
 		// Set flags
 		c.root.PersistentFlags().StringVarP(&c.path, "path", "p", "", "path to the repository")
 
 		// Set persisted pre-run fn
 		c.root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-			return c.fixPath("path (-p)", &c.path)
+			pathGiven := len(c.path) > 0
+			if err := c.fixPath("path (-p)", &c.path); err != nil {
+				return err
+			}
+
+			return c.findRoot(pathGiven)
 		}
 	}
 
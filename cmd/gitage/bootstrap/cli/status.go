@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) statusCmd() *cobra.Command {
+	if c.status == nil {
+		c.status = c.command(
+			"status",
+			"Shows the encryption status of files on the specified path",
+			`status is for showing the encryption status of files on the specified path.
+Only the files meant to be encrypted, according to the repository rules, are shown,
+together with any encrypted file that is not meant to be (orphaned).
+Plain files that Git encrypts itself, through the filter driver (see install),
+are shown as filtered, unless they were staged in plaintext.
+
+It exits with a non-zero code if any file meant to be encrypted is in plaintext,
+either alone or next to its encrypted counterpart (conflict).`,
+		)
+
+		// Set args
+		c.status.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.status.Flags().BoolVar(&c.json, "json", false, "print the status in JSON format")
+
+		// Set run fn
+		c.status.RunE = func(cmd *cobra.Command, args []string) error {
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			statuses, err := repo.Status(c.ctx, c.path)
+			if err != nil {
+				return err
+			}
+
+			if c.json {
+				err = c.printStatusJSON(statuses)
+			} else {
+				c.printStatus(statuses)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			for _, s := range statuses {
+				if s.State.Exposed() {
+					return c.exit(cmd, 1)
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return c.status
+}
+
+func (c *CLI) printStatus(statuses []gitage.FileStatus) {
+	if len(statuses) == 0 {
+		log.For(c.ctx).Println("No files to encrypt found.")
+		return
+	}
+
+	exposed := 0
+	for _, s := range statuses {
+		if len(s.Group) > 0 {
+			log.For(c.ctx).Printf("%-10s %s (group: %s)\n", s.State+":", s.Path, s.Group)
+		} else {
+			log.For(c.ctx).Printf("%-10s %s\n", s.State+":", s.Path)
+		}
+
+		if s.State.Exposed() {
+			exposed++
+		}
+	}
+
+	if exposed > 0 {
+		log.For(c.ctx).Printf("\n%d file(s) meant to be encrypted found in plaintext.\n", exposed)
+	}
+}
+
+func (c *CLI) printStatusJSON(statuses []gitage.FileStatus) error {
+	// Always an array, even if empty.
+	if statuses == nil {
+		statuses = []gitage.FileStatus{}
+	}
+
+	b, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode status: %w", err)
+	}
+
+	log.For(c.ctx).Println(string(b))
+
+	return nil
+}
@@ -3,7 +3,7 @@ package cli
 import (
 	"github.com/spf13/cobra"
 
-	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
 )
 
 func (c *CLI) unregisterCmd() *cobra.Command {
@@ -19,13 +19,32 @@ func (c *CLI) unregisterCmd() *cobra.Command {
 
 		// Set flags
 		c.unregister.Flags().StringArrayVarP(&c.recipients, "recipient", "r", nil, "recipients to encrypt the repository")
-		if err := c.unregister.MarkFlagRequired("recipient"); err != nil {
-			panic(err)
-		}
+		c.unregister.Flags().StringArrayVar(&c.names, "name", nil, "names, emails or labels of the recipients (e.g. alice)")
+		c.unregister.Flags().StringVar(&c.group, "group", "", "group of recipients to unregister them from (e.g. ops)")
+		c.rekeyFlag(c.unregister)
 
 		// Set run fn
 		c.unregister.RunE = func(cmd *cobra.Command, args []string) error {
-			return gitage.Unregister(c.ctx, c.fs, c.path, c.recipients...)
+			if len(c.recipients) == 0 && len(c.names) == 0 {
+				return errNoRecipientsOrNames
+			}
+
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			return c.withRekey(func() error {
+				log.For(c.ctx).Println("Unregistering recipients...")
+
+				if err := repo.UnregisterGroup(c.ctx, c.group, append(c.recipients, c.names...)...); err != nil {
+					return err
+				}
+
+				log.For(c.ctx).Println("Recipients unregistered with success!")
+
+				return nil
+			})
 		}
 	}
 
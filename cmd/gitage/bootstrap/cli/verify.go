@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/log"
+)
+
+func (c *CLI) verifyCmd() *cobra.Command {
+	if c.verify == nil {
+		c.verify = c.command(
+			"verify",
+			"Verifies the encrypted files on the specified path",
+			`verify is for checking, without writing anything, that every encrypted file on the
+specified path is encrypted to the recipients currently registered in the repository,
+as recorded when it was encrypted, that it is not corrupt, and that it can be decrypted.
+
+Files are decrypted with the identities file specified (-i) or, if none is specified,
+with the ones configured in the repository. With no identities, only headers are checked.
+
+It exits with a non-zero code if any problem is found, so it can be used in CI.`,
+		)
+
+		// Set args
+		c.verify.Args = cobra.ExactArgs(0)
+
+		// Set flags
+		c.verify.Flags().StringVarP(&c.identitiesPath, "identities", "i", "", "path to the identities file")
+		c.verify.Flags().BoolVar(&c.json, "json", false, "print the results in JSON format")
+
+		// Set pre-run fn
+		c.verify.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if len(c.identitiesPath) == 0 {
+				return nil
+			}
+			return c.fixPath("identities path (-i)", &c.identitiesPath)
+		}
+
+		// Set run fn
+		c.verify.RunE = func(cmd *cobra.Command, args []string) error {
+			repo, err := c.repository()
+			if err != nil {
+				return err
+			}
+
+			identities, err := c.optionalIdentities()
+			if err != nil {
+				return err
+			}
+
+			checks, err := repo.Verify(c.ctx, c.path, identities...)
+			if err != nil {
+				return err
+			}
+
+			if c.json {
+				if err := c.printChecksJSON(checks); err != nil {
+					return err
+				}
+			} else {
+				if len(identities) == 0 {
+					log.For(c.ctx).Println("No identities found, so only headers are checked.")
+				}
+				c.printChecks(checks)
+			}
+
+			if countFileProblems(checks) > 0 {
+				return c.exit(cmd, 1)
+			}
+
+			return nil
+		}
+	}
+
+	return c.verify
+}
+
+func (c *CLI) printChecks(checks []gitage.FileCheck) {
+	problems := countFileProblems(checks)
+	if problems == 0 {
+		log.For(c.ctx).Printf("%d file(s) verified, no problems found.\n", len(checks))
+		return
+	}
+
+	log.For(c.ctx).Printf("%d problem(s) found in %d file(s):\n", problems, len(checks))
+
+	for _, check := range checks {
+		for _, problem := range check.Problems {
+			log.For(c.ctx).Printf("  %s: %s\n", check.Path, problem)
+		}
+	}
+}
+
+func (c *CLI) printChecksJSON(checks []gitage.FileCheck) error {
+	// Always an array, even if empty.
+	if checks == nil {
+		checks = []gitage.FileCheck{}
+	}
+
+	b, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode results: %w", err)
+	}
+
+	log.For(c.ctx).Println(string(b))
+
+	return nil
+}
+
+func countFileProblems(checks []gitage.FileCheck) int {
+	n := 0
+	for _, check := range checks {
+		n += len(check.Problems)
+	}
+
+	return n
+}
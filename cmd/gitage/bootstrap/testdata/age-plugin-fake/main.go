@@ -0,0 +1,255 @@
+// Command age-plugin-fake is an age plugin that stands in for real ones
+// (e.g. age-plugin-yubikey) in tests, so they can exercise the plugin
+// protocol, as described in https://c2sp.org/age-plugin, with no hardware.
+//
+// Its recipients and identities (age1fake1... and AGE-PLUGIN-FAKE-1...)
+// hold the same secret, which the file key is XOR-ed with, so it is by
+// no means secure.
+//
+// Usage: age-plugin-fake --age-plugin=recipient-v1|identity-v1
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"filippo.io/age/plugin"
+)
+
+const (
+	name = "fake"
+
+	// columns is the length of the lines of stanza bodies.
+	columns = 64
+)
+
+type stanza struct {
+	typ  string
+	args []string
+	body []byte
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: age-plugin-fake --age-plugin=recipient-v1|identity-v1")
+		os.Exit(2)
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	w := os.Stdout
+
+	var err error
+	switch os.Args[1] {
+	case "--age-plugin=recipient-v1":
+		err = recipientV1(r, w)
+	case "--age-plugin=identity-v1":
+		err = identityV1(r, w)
+	default:
+		err = fmt.Errorf("unsupported state machine: %s", os.Args[1])
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "age-plugin-fake: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// recipientV1 wraps each file key for each recipient (or identity).
+func recipientV1(r *bufio.Reader, w io.Writer) error {
+	var secrets, fileKeys [][]byte
+
+	err := readUntilDone(r, func(s *stanza) error {
+		switch s.typ {
+		case "add-recipient":
+			_, secret, err := plugin.ParseRecipient(s.args[0])
+			if err != nil {
+				return err
+			}
+			secrets = append(secrets, secret)
+		case "add-identity":
+			_, secret, err := plugin.ParseIdentity(s.args[0])
+			if err != nil {
+				return err
+			}
+			secrets = append(secrets, secret)
+		case "wrap-file-key":
+			fileKeys = append(fileKeys, s.body)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, fileKey := range fileKeys {
+		for _, secret := range secrets {
+			s := &stanza{
+				typ:  "recipient-stanza",
+				args: []string{strconv.Itoa(i), name, tag(secret)},
+				body: xor(fileKey, secret),
+			}
+			if err := exchange(r, w, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeStanza(w, &stanza{typ: "done"})
+}
+
+// identityV1 unwraps the file keys wrapped for any of the identities.
+func identityV1(r *bufio.Reader, w io.Writer) error {
+	secrets := make(map[string][]byte)
+	fileKeys := make(map[int][]byte)
+
+	var files []int
+	err := readUntilDone(r, func(s *stanza) error {
+		switch s.typ {
+		case "add-identity":
+			_, secret, err := plugin.ParseIdentity(s.args[0])
+			if err != nil {
+				return err
+			}
+			secrets[tag(secret)] = secret
+		case "recipient-stanza":
+			i, err := strconv.Atoi(s.args[0])
+			if err != nil {
+				return err
+			}
+
+			// Stanzas for other recipients are skipped.
+			if len(s.args) != 3 || s.args[1] != name {
+				return nil
+			}
+
+			secret, ok := secrets[s.args[2]]
+			if _, done := fileKeys[i]; !ok || done {
+				return nil
+			}
+
+			fileKeys[i] = xor(s.body, secret)
+			files = append(files, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range files {
+		s := &stanza{typ: "file-key", args: []string{strconv.Itoa(i)}, body: fileKeys[i]}
+		if err := exchange(r, w, s); err != nil {
+			return err
+		}
+	}
+
+	return writeStanza(w, &stanza{typ: "done"})
+}
+
+func tag(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+func xor(fileKey, secret []byte) []byte {
+	out := make([]byte, len(fileKey))
+	for i := range fileKey {
+		out[i] = fileKey[i] ^ secret[i%len(secret)]
+	}
+	return out
+}
+
+// exchange sends the given stanza, and reads the response to it.
+func exchange(r *bufio.Reader, w io.Writer, s *stanza) error {
+	if err := writeStanza(w, s); err != nil {
+		return err
+	}
+
+	resp, err := readStanza(r)
+	if err != nil {
+		return err
+	}
+
+	if resp.typ != "ok" {
+		return fmt.Errorf("unexpected response: %s", resp.typ)
+	}
+
+	return nil
+}
+
+func readUntilDone(r *bufio.Reader, fn func(*stanza) error) error {
+	for {
+		s, err := readStanza(r)
+		if err != nil {
+			return err
+		}
+
+		if s.typ == "done" {
+			return nil
+		}
+
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+}
+
+func readStanza(r *bufio.Reader) (*stanza, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(line, "\n"))
+	if len(fields) < 2 || fields[0] != "->" {
+		return nil, errors.New("malformed stanza")
+	}
+
+	s := &stanza{typ: fields[1], args: fields[2:]}
+
+	// The body ends with the first line shorter than the others.
+	var body strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		body.WriteString(line)
+
+		if len(line) < columns {
+			break
+		}
+	}
+
+	s.body, err = base64.RawStdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func writeStanza(w io.Writer, s *stanza) error {
+	var b strings.Builder
+	b.WriteString(strings.Join(append([]string{"->", s.typ}, s.args...), " ") + "\n")
+
+	body := base64.RawStdEncoding.EncodeToString(s.body)
+	for len(body) >= columns {
+		b.WriteString(body[:columns] + "\n")
+		body = body[columns:]
+	}
+	b.WriteString(body + "\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
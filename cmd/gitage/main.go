@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"os/signal"
 
 	"github.com/go-git/go-billy/v5/osfs"
 
@@ -10,6 +11,12 @@ import (
 )
 
 func main() {
-	ctx := log.Ctx(os.Stdout)
-	bootstrap.Run(ctx, osfs.New(""), os.Args[1:]...)
+	// Interruptions (e.g. Ctrl-C) cancel the context, so
+	// ongoing operations can be rolled back gracefully.
+	ctx, stop := signal.NotifyContext(log.Ctx(os.Stdout), os.Interrupt)
+
+	code := bootstrap.Run(ctx, osfs.New(""), os.Args[1:]...)
+	stop()
+
+	os.Exit(code)
 }
@@ -0,0 +1,228 @@
+package gitage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"gopkg.in/yaml.v3"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// ConfigVersion is the version of the .gitage/config
+// format supported by this version of Gitage.
+const ConfigVersion = 1
+
+// defaultConfig is the contents of the .gitage/config
+// file written by Init, which must be equivalent to the
+// configuration returned by DefaultConfig.
+const defaultConfig = `# Gitage configuration file.
+version: 1
+
+# File extension appended to the name of encrypted files.
+extension: .age
+
+# Patterns of the files to encrypt (fnmatch syntax, relative
+# to the repository root). When empty, every file is encrypted.
+# See also the .gitageattributes file.
+include: []
+
+# Patterns of the files to never encrypt, which take
+# precedence over any other rule.
+exclude: []
+
+# Whether files ignored by Git (.gitignore) are skipped.
+gitignore: true
+
+# Whether encrypted files are ASCII-armored (PEM-encoded)
+# instead of binary, which is friendlier for text diffs.
+armor: false
+
+# Default locations of the identity files used to decrypt
+# files, when no one is specified explicitly (-i).
+# Relative paths are resolved from the repository root,
+# and a leading ~ is expanded to the user's home directory.
+identities:
+  - ~/.config/gitage/identities
+
+# Work factor (the log2 of the scrypt cost) used to encrypt
+# files with a passphrase (--passphrase). Each increment
+# doubles the time it takes to encrypt and decrypt files.
+scrypt-work-factor: 18
+`
+
+// Config represents the contents of the .gitage/config file.
+type Config struct {
+	// Version is the version of the config format.
+	Version int `yaml:"version"`
+
+	// Extension is the file extension appended to the
+	// name of encrypted files (e.g. .age).
+	Extension string `yaml:"extension"`
+
+	// Include are the patterns of the files to encrypt.
+	// When empty, every file is encrypted (see Rules).
+	Include []string `yaml:"include"`
+
+	// Exclude are the patterns of the files to never encrypt.
+	Exclude []string `yaml:"exclude"`
+
+	// Gitignore determines whether files ignored by Git
+	// (.gitignore) are skipped.
+	Gitignore bool `yaml:"gitignore"`
+
+	// Armor determines whether encrypted files are
+	// ASCII-armored instead of binary.
+	Armor bool `yaml:"armor"`
+
+	// Identities are the default locations of the identity
+	// files used to decrypt files.
+	Identities []string `yaml:"identities"`
+
+	// ScryptWorkFactor is the work factor used to encrypt
+	// files with a passphrase (see PassphraseRecipient).
+	ScryptWorkFactor int `yaml:"scrypt-work-factor"`
+
+	// root is the path of the repository the configuration
+	// was loaded from, if any.
+	root string
+}
+
+// DefaultConfig returns the configuration used when
+// the .gitage/config file is missing or empty.
+func DefaultConfig() *Config {
+	return &Config{
+		Version:          ConfigVersion,
+		Extension:        Ext,
+		Gitignore:        true,
+		Armor:            false,
+		Identities:       []string{"~/.config/gitage/identities"},
+		ScryptWorkFactor: DefaultScryptWorkFactor,
+	}
+}
+
+// LoadConfig reads and parses the configuration of the Gitage
+// repository that contains the given path, which is looked up
+// by walking up the directory tree until a .gitage directory is found.
+//
+// Missing fields take their default values (see DefaultConfig).
+//
+// Arguments:
+// - path: must be an absolute path.
+func LoadConfig(f billy.Filesystem, path string) (*Config, error) {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadConfig(f, root)
+}
+
+func loadConfig(f billy.Filesystem, root string) (*Config, error) {
+	configFilepath := filepath.Join(dir(root), "config")
+
+	contents, err := fs.Read(f, configFilepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			cfg := DefaultConfig()
+			cfg.root = root
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	cfg, err := ParseConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("malformed config %s: %w", configFilepath, err)
+	}
+
+	cfg.root = root
+
+	return cfg, nil
+}
+
+// configFor returns the configuration of the Gitage repository
+// that contains the given path, or the default configuration
+// if the path is not within a Gitage repository.
+func configFor(f billy.Filesystem, path string) (*Config, error) {
+	cfg, err := LoadConfig(f, path)
+	if errors.Is(err, ErrNotARepository) {
+		return DefaultConfig(), nil
+	}
+
+	return cfg, err
+}
+
+// ParseConfig parses a configuration, like the one stored
+// in the .gitage/config file, and validates it.
+//
+// Unknown fields are considered an error.
+func ParseConfig(r io.Reader) (*Config, error) {
+	cfg := DefaultConfig()
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.Version != ConfigVersion {
+		return fmt.Errorf("unsupported version %d (expected %d)", c.Version, ConfigVersion)
+	}
+
+	if len(c.Extension) < 2 || !strings.HasPrefix(c.Extension, ".") || strings.ContainsAny(c.Extension, `/\`) {
+		return fmt.Errorf("invalid extension %q (expected something like %q)", c.Extension, Ext)
+	}
+
+	if c.ScryptWorkFactor < 1 || c.ScryptWorkFactor > maxScryptWorkFactor {
+		return fmt.Errorf("invalid scrypt work factor %d (expected 1-%d)", c.ScryptWorkFactor, maxScryptWorkFactor)
+	}
+
+	return nil
+}
+
+// IdentityFiles returns the default locations of the identity
+// files, resolved against the repository root and the user's
+// home directory.
+//
+// Relative locations are omitted when the configuration
+// was not loaded from a repository.
+func (c *Config) IdentityFiles() []string {
+	files := make([]string, 0, len(c.Identities))
+
+	for _, path := range c.Identities {
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			path = filepath.Join(home, path[1:])
+		}
+
+		if !filepath.IsAbs(path) {
+			if len(c.root) == 0 {
+				continue
+			}
+			path = filepath.Join(c.root, path)
+		}
+
+		files = append(files, filepath.Clean(path))
+	}
+
+	return files
+}
@@ -1,13 +1,17 @@
 package gitage
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	stdfs "io/fs"
-	"path/filepath"
+	"strings"
 
 	"filippo.io/age"
+	"filippo.io/age/armor"
 	"github.com/go-git/go-billy/v5"
 
 	"github.com/joanlopez/gitage/internal/fs"
@@ -17,14 +21,78 @@ import (
 // so it is equivalent to calling DecryptFile for each
 // file in the given path, recursively.
 //
-// It skips directories (files are decrypted individually)
-// and non-encrypted files (files without the .age extension)
-// to avoid double decryption.
+// It skips directories (files are decrypted individually),
+// non-encrypted files (files without the .age extension)
+// to avoid double decryption, and files that do not match
+// the rules of the repository (see Rules).
+//
+// It never walks into the Git and Gitage directories, and it
+// also skips Git and Gitage metadata files (e.g. .gitignore)
+// and the files ignored by Git, unless configured otherwise.
+//
+// Files are processed concurrently, as many at once as the context says
+// (see WithJobs). Any failure, or the cancellation of the
+// context, rolls back the whole operation (see Recover).
+func (r *Repository) DecryptAll(ctx context.Context, path string, identities ...age.Identity) error {
+	path, err := r.abs(path)
+	if err != nil {
+		return err
+	}
+
+	return r.decryptAll(ctx, path, identities...)
+}
+
+// DecryptAll decrypts all files in the specified path, recursively,
+// as Repository.DecryptAll does, within the Gitage repository that
+// contains the path, if any, or with the default configuration
+// otherwise.
 //
 // Arguments:
 // - path: must be an absolute path.
 func DecryptAll(ctx context.Context, f billy.Filesystem, path string, identities ...age.Identity) error {
-	return fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
+	r, err := repositoryFor(f, path)
+	if err != nil {
+		return err
+	}
+
+	return r.decryptAll(ctx, path, identities...)
+}
+
+func (r *Repository) decryptAll(ctx context.Context, path string, identities ...age.Identity) error {
+	f := r.f
+
+	// Files may be processed concurrently (see WithJobs).
+	if jobsFrom(ctx) > 1 {
+		f = fs.Synchronized(f)
+	}
+
+	rules, err := loadRules(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	skip, err := skipPolicy(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	cache, m, err := openDecryptCache(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	j, err := openJournal(ctx, f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	var ops []op
+
+	// The fingerprint of the recipients of each file, resolved
+	// while walking, as files may be processed concurrently later on.
+	fingerprints := make(map[string]string)
+
+	err = fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -35,70 +103,207 @@ func DecryptAll(ctx context.Context, f billy.Filesystem, path string, identities
 		}
 
 		// Skip non-encrypted files
-		if filepath.Ext(path) != Ext {
+		if !strings.HasSuffix(path, r.cfg.Extension) {
+			return nil
+		}
+
+		// Skip files not meant to be encrypted
+		plainPath := strings.TrimSuffix(path, r.cfg.Extension)
+		if !rules.Match(plainPath) {
 			return nil
 		}
 
-		err = DecryptFile(ctx, f, path, identities...)
+		fingerprint, err := m.recorded(f, r.root, path)
 		if err != nil {
 			return err
 		}
 
+		ops = append(ops, newOp(path, plainPath))
+		fingerprints[path] = fingerprint
+
 		return nil
+	}, skip)
+	if err != nil {
+		return j.abort(err)
+	}
+
+	return j.run(ctx, ops, func(o op) error {
+		return decryptOp(ctx, f, cache, o, fingerprints[o.src], identities...)
 	})
 }
 
 // DecryptFile decrypts the file present at the given
-// path, within the given file-system, using the given
-// identities.
+// path, using the given identities.
 //
 // In comparison to Decrypt, it replaces the ciphered
 // file with the decrypted one (w/out the .age extension).
 //
-// So, assuming it can be called with a non-transactional
-// file-system, use it with care. An unsuccessful operation
-// will leave the file-system in an inconsistent state.
+// The decrypted file is written to a temporary file first,
+// which is renamed into place once complete, and the ciphered
+// file is only removed afterwards, so an unsuccessful operation
+// (e.g. a wrong identity) leaves the ciphered file untouched.
+//
+// It fails if the file does not have the encrypted extension (.age).
+func (r *Repository) DecryptFile(ctx context.Context, path string, identities ...age.Identity) error {
+	path, err := r.abs(path)
+	if err != nil {
+		return err
+	}
+
+	return r.decryptFile(ctx, path, identities...)
+}
+
+// DecryptFile decrypts the file present at the given path, within
+// the given file-system, as Repository.DecryptFile does, within the
+// Gitage repository that contains the path, if any, or with the
+// default configuration otherwise.
 //
 // Arguments:
 // - path: must be an absolute path.
 func DecryptFile(ctx context.Context, f billy.Filesystem, path string, identities ...age.Identity) error {
-	read, err := fs.Read(f, path)
+	r, err := repositoryFor(f, path)
 	if err != nil {
 		return err
 	}
 
-	if err = fs.RemoveAll(f, path); err != nil {
+	return r.decryptFile(ctx, path, identities...)
+}
+
+func (r *Repository) decryptFile(ctx context.Context, path string, identities ...age.Identity) error {
+	if !strings.HasSuffix(path, r.cfg.Extension) {
+		return fmt.Errorf("%s is not encrypted (no %s extension)", path, r.cfg.Extension)
+	}
+
+	cache, m, err := openDecryptCache(r.f, r.cfg)
+	if err != nil {
 		return err
 	}
 
-	toWrite, err := Decrypt(ctx, read, identities...)
+	fingerprint, err := m.recorded(r.f, r.root, path)
 	if err != nil {
 		return err
 	}
 
-	path = path[:len(path)-len(Ext)]
+	plainPath := strings.TrimSuffix(path, r.cfg.Extension)
+
+	return newOp(path, plainPath).run(r.f, func(o op) error {
+		return decryptOp(ctx, r.f, cache, o, fingerprint, identities...)
+	})
+}
 
-	err = fs.Create(f, path, toWrite)
+// openDecryptCache opens the blob cache (see blobCache), along with
+// the manifest, which tells the recipients files are encrypted to,
+// which are both nil outside a repository, where there is nothing
+// to cache.
+func openDecryptCache(f billy.Filesystem, cfg *Config) (*blobCache, *manifest, error) {
+	cache, err := openBlobCache(f, cfg)
+	if err != nil || cache == nil {
+		return nil, nil, err
+	}
+
+	m, err := readManifest(f, cfg.root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cache, m, nil
+}
+
+// decryptOp prepares the given operation, by decrypting
+// the ciphered file (src) into the temporary file (tmp).
+//
+// The ciphertext is cached along with the keyed hash of the
+// plain contents (see blobCache), so it is reused when the
+// file is encrypted back, if it did not change meanwhile,
+// unless the fingerprint of its recipients is not known.
+func decryptOp(ctx context.Context, f billy.Filesystem, cache *blobCache, o op, fingerprint string, identities ...age.Identity) error {
+	var sum []byte
+
+	err := o.stream(f, func(dst io.Writer, src io.Reader) error {
+		br := bufio.NewReader(src)
+		intro, _ := br.Peek(len(armor.Header))
+
+		h := cache.hash(cache.name(o.dst), isArmored(intro))
+		if h != nil {
+			dst = io.MultiWriter(dst, h)
+		}
+
+		if err := DecryptStream(ctx, dst, br, identities...); err != nil {
+			return err
+		}
+
+		if h != nil {
+			sum = h.Sum(nil)
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return cache.storeFile(cache.name(o.dst), sum, fingerprint, o.src)
 }
 
 // Decrypt decrypts the given ciphertext using the given
 // recipients and 'age' encryption tool (Go library).
-func Decrypt(_ context.Context, ciphertext []byte, identities ...age.Identity) ([]byte, error) {
+//
+// The ciphertext can be either binary or ASCII-armored.
+func Decrypt(ctx context.Context, ciphertext []byte, identities ...age.Identity) ([]byte, error) {
 	buff := new(bytes.Buffer)
 
-	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
-	if err != nil {
+	if err := DecryptStream(ctx, buff, bytes.NewReader(ciphertext), identities...); err != nil {
 		return nil, err
 	}
 
-	if _, err = io.Copy(buff, r); err != nil {
-		return nil, err
+	return buff.Bytes(), nil
+}
+
+// DecryptStream decrypts the ciphertext read from src into dst,
+// using the given identities and 'age' encryption tool (Go library).
+//
+// In comparison to Decrypt, the ciphertext is processed in chunks,
+// so the memory used is constant, no matter how large it is.
+//
+// The ciphertext can be either binary or ASCII-armored.
+// It stops as soon as the given context is cancelled.
+func DecryptStream(ctx context.Context, dst io.Writer, src io.Reader, identities ...age.Identity) error {
+	r, err := decryptReader(src, identities...)
+	if err != nil {
+		return err
 	}
 
-	return buff.Bytes(), nil
+	_, err = io.Copy(dst, ctxReader{ctx: ctx, r: r})
+
+	return err
+}
+
+// decryptReader returns a reader of the plain contents of the
+// ciphertext read from src, either binary or ASCII-armored.
+//
+// The error returned when none of the identities matches
+// also matches ErrNoMatchingIdentity (see errors.Is).
+func decryptReader(src io.Reader, identities ...age.Identity) (io.Reader, error) {
+	r, err := age.Decrypt(dearmor(src), identities...)
+
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, noMatchError{err: err}
+	}
+
+	return r, err
+}
+
+// dearmor returns a reader that decodes the ASCII-armored
+// data read from r, if it is armored, or r as is otherwise.
+func dearmor(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+
+	const armorIntro = "-----BEGIN"
+	intro, _ := br.Peek(len(armorIntro))
+	if string(intro) == armorIntro {
+		return armor.NewReader(br)
+	}
+
+	return br
 }
@@ -1,9 +1,109 @@
 package gitage
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
 )
 
+// dirName is the name of the directory that holds
+// the metadata of a Gitage repository.
+const dirName = ".gitage"
+
 func dir(path string) string {
-	return filepath.Join(path, ".gitage")
+	return filepath.Join(path, dirName)
+}
+
+// FindRoot returns the root of the Gitage repository that contains
+// the given path, which is the closest directory, starting from the
+// path and walking up the directory tree, that contains the .gitage
+// directory.
+//
+// Like Git, it never walks beyond the root of the Git working tree
+// the path is in (the directory with the .git directory, or file),
+// nor across file systems (e.g. mount points), and it returns
+// ErrNotARepository if no repository is found within those.
+//
+// Arguments:
+// - path: must be an absolute path.
+func FindRoot(f billy.Filesystem, path string) (string, error) {
+	// A file is within the directory it is in.
+	if info, err := f.Stat(path); err == nil && !info.IsDir() {
+		path = filepath.Dir(path)
+	}
+
+	device, knownDevice := deviceOf(f, path)
+
+	for {
+		info, err := f.Stat(dir(path))
+		if err == nil && info.IsDir() {
+			return path, nil
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		// The root of the Git working tree (or submodule).
+		if _, err := f.Stat(filepath.Join(path, ".git")); err == nil {
+			return "", ErrNotARepository
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", ErrNotARepository
+		}
+
+		// The boundary of the file system.
+		if parentDevice, ok := deviceOf(f, parent); ok {
+			if knownDevice && parentDevice != device {
+				return "", ErrNotARepository
+			}
+			device, knownDevice = parentDevice, true
+		}
+
+		path = parent
+	}
+}
+
+// DirRoot returns the root of the Gitage repository with the given
+// .gitage directory, for when it is known instead of looked up (see
+// FindRoot), like $GIT_DIR does for Git.
+//
+// It returns ErrNotARepository if the path is not a .gitage directory.
+//
+// Arguments:
+// - gitageDir: must be an absolute path.
+func DirRoot(f billy.Filesystem, gitageDir string) (string, error) {
+	if filepath.Base(gitageDir) != dirName {
+		return "", fmt.Errorf("%w: not a %s directory: %s", ErrNotARepository, dirName, gitageDir)
+	}
+
+	info, err := f.Stat(gitageDir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s not found", ErrNotARepository, gitageDir)
+	}
+
+	return filepath.Dir(gitageDir), nil
+}
+
+// deviceOf returns the identifier of the device (file system)
+// the given path is on, if known (see fs.Device).
+func deviceOf(f billy.Filesystem, path string) (uint64, bool) {
+	info, err := f.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+
+	return fs.Device(info)
 }
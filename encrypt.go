@@ -3,11 +3,13 @@ package gitage
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	stdfs "io/fs"
-	"path/filepath"
+	"strings"
 
 	"filippo.io/age"
+	"filippo.io/age/armor"
 	"github.com/go-git/go-billy/v5"
 
 	"github.com/joanlopez/gitage/internal/fs"
@@ -17,14 +19,94 @@ import (
 // so it is equivalent to calling EncryptFile for each
 // file in the given path, recursively.
 //
-// It skips directories (files are encrypted individually)
-// and encrypted files (files with the .age extension) to
-// avoid double encryption.
+// It skips directories (files are encrypted individually),
+// encrypted files (files with the .age extension) to avoid
+// double encryption, and files that do not match the rules
+// of the repository (see Rules).
+//
+// It never walks into the Git and Gitage directories, and it
+// also skips Git and Gitage metadata files (e.g. .gitignore)
+// and the files ignored by Git, unless configured otherwise.
+//
+// If no recipients are given, the ones registered in the
+// repository are used, for the group each file belongs to
+// (see Rules.Group), along with the ones set in the context
+// (see WithRecipients), and the files that did not change
+// since they were last encrypted (or decrypted) keep their
+// ciphertext, so Git does not see them as modified.
+//
+// The recipients each file is encrypted to are recorded in the
+// .gitage/manifest file, as age hides them (see Verify).
+//
+// Files are processed concurrently, as many at once as the context says
+// (see WithJobs). Any failure, or the cancellation of the
+// context, rolls back the whole operation (see Recover).
+func (r *Repository) EncryptAll(ctx context.Context, path string, recipients ...age.Recipient) error {
+	path, err := r.abs(path)
+	if err != nil {
+		return err
+	}
+
+	return r.encryptAll(ctx, path, recipients...)
+}
+
+// EncryptAll encrypts all files in the specified path, recursively,
+// as Repository.EncryptAll does, within the Gitage repository that
+// contains the path, if any, or with the default configuration and
+// the given recipients otherwise.
 //
 // Arguments:
 // - path: must be an absolute path.
 func EncryptAll(ctx context.Context, f billy.Filesystem, path string, recipients ...age.Recipient) error {
-	return fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
+	r, err := repositoryFor(f, path)
+	if err != nil {
+		return err
+	}
+
+	return r.encryptAll(ctx, path, recipients...)
+}
+
+func (r *Repository) encryptAll(ctx context.Context, path string, recipients ...age.Recipient) error {
+	f := r.f
+
+	// Files may be processed concurrently (see WithJobs).
+	if jobsFrom(ctx) > 1 {
+		f = fs.Synchronized(f)
+	}
+
+	rules, err := loadRules(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	skip, err := skipPolicy(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := newRecipientsResolver(f, r.cfg, rules, recipients...)
+	if err != nil {
+		return err
+	}
+	resolver.additional = recipientsFrom(ctx)
+
+	cache, err := openBlobCache(f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	j, err := openJournal(ctx, f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	var ops []op
+
+	// The recipients of each file, resolved while walking,
+	// as files may be processed concurrently later on.
+	recipientsOf := make(map[string]fileRecipients)
+
+	err = fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -35,64 +117,226 @@ func EncryptAll(ctx context.Context, f billy.Filesystem, path string, recipients
 		}
 
 		// Skip encrypted files
-		if filepath.Ext(path) == Ext {
+		if strings.HasSuffix(path, r.cfg.Extension) {
 			return nil
 		}
 
-		return EncryptFile(ctx, f, path, recipients...)
+		// Skip files not meant to be encrypted
+		if !rules.Match(path) {
+			return nil
+		}
+
+		recipients, err := resolver.forFile(path)
+		if err != nil {
+			return err
+		}
+
+		ops = append(ops, newOp(path, path+r.cfg.Extension))
+		recipientsOf[path] = recipients
+
+		return nil
+	}, skip)
+	if err != nil {
+		return j.abort(err)
+	}
+
+	err = j.run(ctx, ops, func(o op) error {
+		return encryptOp(ctx, f, r.cfg, cache, o, recipientsOf[o.src])
 	})
+	if err != nil {
+		return err
+	}
+
+	fingerprints := make(map[string]string, len(ops))
+	for _, o := range ops {
+		fingerprints[o.dst] = recipientsOf[o.src].fingerprint
+	}
+
+	return recordRecipients(f, r.root, fingerprints)
 }
 
 // EncryptFile encrypts the file present at the given
-// path, within the given file-system, using the given
-// recipients.
+// path, using the given recipients.
 //
 // In comparison to Encrypt, it replaces the plain file
 // with the encrypted one (with the .age extension).
 //
-// So, assuming it can be called with a non-transactional
-// file-system, use it with care. An unsuccessful operation
-// will leave the file-system in an inconsistent state.
+// The encrypted file is written to a temporary file first,
+// which is renamed into place once complete, and the plain
+// file is only removed afterwards, so an unsuccessful operation
+// leaves the plain file untouched.
+//
+// If no recipients are given, the ones registered in the
+// repository are used, for the group the file belongs to
+// (see Rules.Group), along with the ones set in the context
+// (see WithRecipients), and the file keeps its ciphertext if
+// it did not change since it was last encrypted (or decrypted).
+//
+// It returns ErrAlreadyEncrypted if the file has the
+// encrypted extension (.age), to avoid double encryption.
+func (r *Repository) EncryptFile(ctx context.Context, path string, recipients ...age.Recipient) error {
+	path, err := r.abs(path)
+	if err != nil {
+		return err
+	}
+
+	return r.encryptFile(ctx, path, recipients...)
+}
+
+// EncryptFile encrypts the file present at the given path, within
+// the given file-system, as Repository.EncryptFile does, within the
+// Gitage repository that contains the path, if any, or with the
+// default configuration and the given recipients otherwise.
 //
 // Arguments:
 // - path: must be an absolute path.
 func EncryptFile(ctx context.Context, f billy.Filesystem, path string, recipients ...age.Recipient) error {
-	read, err := fs.Read(f, path)
+	r, err := repositoryFor(f, path)
+	if err != nil {
+		return err
+	}
+
+	return r.encryptFile(ctx, path, recipients...)
+}
+
+func (r *Repository) encryptFile(ctx context.Context, path string, recipients ...age.Recipient) error {
+	if strings.HasSuffix(path, r.cfg.Extension) {
+		return fmt.Errorf("%w: %s", ErrAlreadyEncrypted, path)
+	}
+
+	rules, err := loadRules(r.f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := newRecipientsResolver(r.f, r.cfg, rules, recipients...)
+	if err != nil {
+		return err
+	}
+	resolver.additional = recipientsFrom(ctx)
+
+	resolved, err := resolver.forFile(path)
 	if err != nil {
 		return err
 	}
 
-	if err = fs.RemoveAll(f, path); err != nil {
+	cache, err := openBlobCache(r.f, r.cfg)
+	if err != nil {
 		return err
 	}
 
-	toWrite, err := Encrypt(ctx, read, recipients...)
+	o := newOp(path, path+r.cfg.Extension)
+
+	err = o.run(r.f, func(o op) error {
+		return encryptOp(ctx, r.f, r.cfg, cache, o, resolved)
+	})
 	if err != nil {
 		return err
 	}
 
-	agedPath := path + Ext
+	return recordRecipients(r.f, r.root, map[string]string{o.dst: resolved.fingerprint})
+}
+
+// encryptOp prepares the given operation, by encrypting
+// the plain file (src) into the temporary file (tmp).
+//
+// If the plain file did not change since it was last encrypted
+// (or decrypted), to the same recipients, its cached ciphertext
+// is reused instead (see blobCache), so it does not change either.
+// Recipients that are not the registered ones (e.g. given
+// explicitly) are never cached, so they are always used as given.
+func encryptOp(ctx context.Context, f billy.Filesystem, cfg *Config, cache *blobCache, o op, r fileRecipients) error {
+	var sum []byte
+	if len(r.fingerprint) > 0 {
+		var err error
+		if sum, err = cache.sumFile(o.src, cfg.Armor); err != nil {
+			return err
+		}
+	}
+
+	var reused bool
+	err := o.stream(f, func(dst io.Writer, src io.Reader) error {
+		ok, err := cache.reuse(dst, cache.name(o.src), sum, r.fingerprint)
+		if ok || err != nil {
+			reused = ok
+			return err
+		}
+
+		return encryptStream(ctx, dst, src, cfg.Armor, r.recipients...)
+	})
+	if err != nil || reused {
+		return err
+	}
 
-	return fs.Create(f, agedPath, toWrite)
+	return cache.storeFile(cache.name(o.src), sum, r.fingerprint, o.tmp)
 }
 
 // Encrypt encrypts the given plaintext using the given
 // recipients and 'age' encryption tool (Go library).
-func Encrypt(_ context.Context, plaintext []byte, recipients ...age.Recipient) ([]byte, error) {
+func Encrypt(ctx context.Context, plaintext []byte, recipients ...age.Recipient) ([]byte, error) {
 	buff := new(bytes.Buffer)
 
-	w, err := age.Encrypt(buff, recipients...)
-	if err != nil {
+	if err := EncryptStream(ctx, buff, bytes.NewReader(plaintext), recipients...); err != nil {
 		return nil, err
 	}
 
-	if _, err = io.Copy(w, bytes.NewReader(plaintext)); err != nil {
-		return nil, err
+	return buff.Bytes(), nil
+}
+
+// EncryptStream encrypts the plaintext read from src into dst,
+// using the given recipients and 'age' encryption tool (Go library).
+//
+// In comparison to Encrypt, the plaintext is processed in chunks,
+// so the memory used is constant, no matter how large it is.
+//
+// It stops as soon as the given context is cancelled.
+func EncryptStream(ctx context.Context, dst io.Writer, src io.Reader, recipients ...age.Recipient) error {
+	return encryptStream(ctx, dst, src, false, recipients...)
+}
+
+func encryptStream(ctx context.Context, dst io.Writer, src io.Reader, armored bool, recipients ...age.Recipient) error {
+	if err := checkRecipients(recipients...); err != nil {
+		return err
+	}
+
+	var out io.WriteCloser = nopCloser{dst}
+	if armored {
+		out = armor.NewWriter(dst)
+	}
+
+	w, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(w, ctxReader{ctx: ctx, r: src}); err != nil {
+		return err
 	}
 
 	if err = w.Close(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return buff.Bytes(), nil
+	return out.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// ctxReader is a reader that stops reading
+// once the given context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
 }
@@ -0,0 +1,57 @@
+package gitage
+
+import (
+	"errors"
+)
+
+// Errors returned by the operations of this package, wrapped along
+// with the details of each failure, so they must be checked with
+// errors.Is, rather than compared directly.
+var (
+	// ErrNotARepository is returned when the given path is not
+	// within a Gitage repository (no .gitage directory found).
+	ErrNotARepository = errors.New("not a gitage repository (or any of the parent directories)")
+
+	// ErrAlreadyInitialized is returned when initializing a Gitage
+	// repository where there is one already (see InitRepository).
+	ErrAlreadyInitialized = errors.New("gitage repository already initialized")
+
+	// ErrOutsideRepository is returned when a path given
+	// to a Repository is not within the repository.
+	ErrOutsideRepository = errors.New("path outside the repository")
+
+	// ErrNoRecipients is returned when encrypting with no recipients,
+	// neither given explicitly nor registered in the repository.
+	ErrNoRecipients = errors.New("no recipients specified nor registered")
+
+	// ErrNoMatchingIdentity is returned when decrypting a file
+	// that none of the given identities can decrypt.
+	ErrNoMatchingIdentity = errors.New("no identity matched any of the recipients")
+
+	// ErrAlreadyEncrypted is returned when encrypting a file that
+	// is already encrypted (i.e. it has the encrypted extension).
+	ErrAlreadyEncrypted = errors.New("file already encrypted")
+
+	// ErrLocked is returned when starting a multi-file operation
+	// (e.g. EncryptAll) while another one holds the lock of the
+	// repository (the .gitage/lock file).
+	ErrLocked = errors.New("another gitage operation is in progress")
+)
+
+// noMatchError is the error returned by age when none of the
+// identities matches, which also matches ErrNoMatchingIdentity.
+type noMatchError struct {
+	err error
+}
+
+func (e noMatchError) Error() string {
+	return e.err.Error()
+}
+
+func (e noMatchError) Unwrap() error {
+	return e.err
+}
+
+func (e noMatchError) Is(target error) bool {
+	return target == ErrNoMatchingIdentity
+}
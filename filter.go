@@ -0,0 +1,238 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+)
+
+// headerSize is the size of the buffer contents are read through
+// to tell whether they are age-encrypted (see isEncrypted), which
+// must hold their whole header, even with many recipients.
+const headerSize = 64 << 10
+
+// Filter implements Git's clean and smudge filters, so Git
+// stores encrypted contents in its object store, while the
+// working tree holds the plain ones (see Install).
+type Filter struct {
+	f          billy.Filesystem
+	path       string
+	cfg        *Config
+	rules      *Rules
+	recipients *recipientsResolver
+	cache      *blobCache
+	identities []age.Identity
+}
+
+// NewFilter returns a filter for the Gitage repository that
+// contains the given path, which decrypts contents with the
+// given identities, and encrypts them to the recipients
+// registered in the repository, for the group of each file.
+//
+// Files keep their ciphertext while their plain contents do not
+// change, so Git does not see them as modified every time they
+// are cleaned.
+//
+// Arguments:
+// - path: must be an absolute path.
+func NewFilter(f billy.Filesystem, path string, identities ...age.Identity) (*Filter, error) {
+	cfg, err := LoadConfig(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadRules(f, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recipients are only loaded when first needed, to clean contents,
+	// so smudging them still works with no recipients registered.
+	recipients, err := newRecipientsResolver(f, cfg, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := openBlobCache(f, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		f:          f,
+		path:       path,
+		cfg:        cfg,
+		rules:      rules,
+		recipients: recipients,
+		cache:      cache,
+		identities: identities,
+	}, nil
+}
+
+// Clean encrypts the plain contents of the file with the given name,
+// read from src, into dst, to the recipients registered in the
+// repository, for the group the file belongs to (see Rules.Group).
+//
+// The name is the path of the file, relative to the root of the
+// repository, as given by Git, or empty for the default group.
+//
+// Contents that are already encrypted are copied as is,
+// so they are never encrypted twice.
+func (flt *Filter) Clean(ctx context.Context, name string, dst io.Writer, src io.Reader) error {
+	br := bufio.NewReaderSize(src, headerSize)
+	if isEncrypted(br) {
+		_, err := io.Copy(dst, br)
+		return err
+	}
+
+	resolved, err := flt.recipients.forGroup(flt.group(name))
+	if err != nil {
+		return err
+	}
+
+	// The plain contents are read in full (Git already holds them in
+	// memory), so the cached ciphertext can be reused, if they match.
+	plaintext, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+
+	sum, err := flt.cache.sum(name, flt.cfg.Armor, bytes.NewReader(plaintext))
+	if err != nil {
+		return err
+	}
+
+	if reused, err := flt.cache.reuse(dst, name, sum, resolved.fingerprint); reused || err != nil {
+		return err
+	}
+
+	ciphertext := new(bytes.Buffer)
+	if err := encryptStream(ctx, ciphertext, bytes.NewReader(plaintext), flt.cfg.Armor, resolved.recipients...); err != nil {
+		return err
+	}
+
+	if err := flt.cache.store(name, sum, resolved.fingerprint, bytes.NewReader(ciphertext.Bytes())); err != nil {
+		return err
+	}
+
+	_, err = dst.Write(ciphertext.Bytes())
+
+	return err
+}
+
+// Smudge decrypts the encrypted contents of the file with the given
+// name (see Clean), read from src, into dst, with the identities given
+// to the filter, and caches them, so cleaning the file back gives the
+// same ciphertext, as long as it does not change, if the recipients it
+// is encrypted to are recorded in the manifest (see manifest).
+//
+// Contents that are not encrypted, or that cannot be decrypted with
+// the identities given (e.g. there are none), are copied as is, so
+// the working tree holds the encrypted contents, like a locked one.
+func (flt *Filter) Smudge(ctx context.Context, name string, dst io.Writer, src io.Reader) error {
+	br := bufio.NewReaderSize(src, headerSize)
+	if !isEncrypted(br) || len(flt.identities) == 0 {
+		_, err := io.Copy(dst, br)
+		return err
+	}
+
+	// The ciphertext is read in full (Git already holds it in memory),
+	// so it can be written as is if no identity matches.
+	ciphertext, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+
+	r, err := age.Decrypt(dearmor(bytes.NewReader(ciphertext)), flt.identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		_, err = dst.Write(ciphertext)
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := flt.recordedFingerprint(name, ciphertext)
+	if err != nil {
+		return err
+	}
+
+	var h hash.Hash
+	if len(fingerprint) > 0 {
+		h = flt.cache.hash(name, isArmored(ciphertext))
+	}
+
+	if h != nil {
+		dst = io.MultiWriter(dst, h)
+	}
+
+	if _, err := io.Copy(dst, ctxReader{ctx: ctx, r: r}); err != nil {
+		return err
+	}
+
+	if h == nil {
+		return nil
+	}
+
+	return flt.cache.store(name, h.Sum(nil), fingerprint, bytes.NewReader(ciphertext))
+}
+
+// recordedFingerprint returns the fingerprint of the recipients the
+// given ciphertext of the file with the given name (see Clean) is
+// encrypted to, as recorded in the manifest, or empty if unknown.
+func (flt *Filter) recordedFingerprint(name string, ciphertext []byte) (string, error) {
+	if flt.cache == nil {
+		return "", nil
+	}
+
+	m, err := readManifest(flt.f, flt.cfg.root)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(ciphertext)
+
+	return m.recordedFor(name, hex.EncodeToString(sum[:])), nil
+}
+
+// group returns the group of the file with the given name
+// (see Clean), which is the default one if it has no name.
+func (flt *Filter) group(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+
+	return flt.rules.Group(filepath.Join(flt.cfg.root, filepath.FromSlash(name)))
+}
+
+// isEncrypted reports whether the contents read through the given
+// reader are age-encrypted, either binary or ASCII-armored, by parsing
+// their header, as age does, without consuming them.
+func isEncrypted(br *bufio.Reader) bool {
+	peeked, _ := br.Peek(br.Size())
+
+	// The header is parsed before any identity is tried.
+	_, err := age.Decrypt(dearmor(bytes.NewReader(peeked)), headerProbe{})
+
+	var noMatch *age.NoIdentityMatchError
+	return errors.As(err, &noMatch)
+}
+
+// headerProbe is an identity that matches no recipient,
+// so decrypting with it only parses the header.
+type headerProbe struct{}
+
+func (headerProbe) Unwrap([]*age.Stanza) ([]byte, error) {
+	return nil, age.ErrIncorrectIdentity
+}
@@ -0,0 +1,205 @@
+package gitage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joanlopez/gitage"
+	"github.com/joanlopez/gitage/internal/fs/fstest"
+)
+
+func TestFilter_Clean(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	flt := newFilter(t, newFilterFS(t, alice, bob))
+
+	// Files outside any group are encrypted to the default one.
+	ciphertext := clean(t, flt, "app.env", "TOKEN=secret\n")
+	assert.Equal(t, "TOKEN=secret\n", decrypt(t, ciphertext, alice))
+	assertNoMatch(t, ciphertext, bob)
+
+	// Files within a group are only encrypted to that group.
+	ciphertext = clean(t, flt, "prod/db.env", "DB_PASSWORD=secret\n")
+	assert.Equal(t, "DB_PASSWORD=secret\n", decrypt(t, ciphertext, bob))
+	assertNoMatch(t, ciphertext, alice)
+}
+
+func TestFilter_CleanEncrypted(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	flt := newFilter(t, newFilterFS(t, alice, bob))
+
+	ciphertext, err := gitage.Encrypt(context.Background(), []byte("TOKEN=secret\n"), alice.Recipient())
+	require.NoError(t, err)
+
+	assert.Equal(t, ciphertext, clean(t, flt, "app.env", string(ciphertext)))
+}
+
+func TestFilter_CleanUnchanged(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	flt := newFilter(t, newFilterFS(t, alice, bob))
+
+	ciphertext := clean(t, flt, "app.env", "TOKEN=secret\n")
+	assert.Equal(t, ciphertext, clean(t, flt, "app.env", "TOKEN=secret\n"))
+	assert.NotEqual(t, ciphertext, clean(t, flt, "app.env", "TOKEN=changed\n"))
+}
+
+func TestFilter_CleanRecipientsChanged(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	f := newFilterFS(t, alice, bob)
+
+	ciphertext := clean(t, newFilter(t, f), "app.env", "TOKEN=secret\n")
+
+	// Bob replaces Alice in the default group.
+	recipients := fstest.Rootify("/repo/.gitage/recipients")
+	require.NoError(t, util.WriteFile(f, recipients, []byte(bob.Recipient().String()+"\n"), 0o644))
+
+	reencrypted := clean(t, newFilter(t, f), "app.env", "TOKEN=secret\n")
+	assert.NotEqual(t, ciphertext, reencrypted)
+	assert.Equal(t, "TOKEN=secret\n", decrypt(t, reencrypted, bob))
+	assertNoMatch(t, reencrypted, alice)
+}
+
+func TestFilter_CacheKeyMode(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	f := newFilterFS(t, alice, bob)
+	newFilter(t, f)
+
+	info, err := f.Stat(fstest.Rootify("/repo/.gitage/cache/key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestFilter_SmudgeNoMatchingIdentity(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	flt := newFilter(t, newFilterFS(t, alice, bob), newIdentity(t))
+
+	ciphertext, err := gitage.Encrypt(context.Background(), []byte("TOKEN=secret\n"), alice.Recipient())
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, flt.Smudge(context.Background(), "app.env", out, bytes.NewReader(ciphertext)))
+	assert.Equal(t, ciphertext, out.Bytes())
+}
+
+func TestFilter_SmudgeCache(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newIdentity(t), newIdentity(t)
+	f := newFilterFS(t, alice, bob)
+	flt := newFilter(t, f, alice)
+
+	ciphertext, err := gitage.Encrypt(context.Background(), []byte("TOKEN=secret\n"), alice.Recipient())
+	require.NoError(t, err)
+
+	smudge := func() {
+		out := new(bytes.Buffer)
+		require.NoError(t, flt.Smudge(context.Background(), "app.env", out, bytes.NewReader(ciphertext)))
+		require.Equal(t, "TOKEN=secret\n", out.String())
+	}
+
+	// The recipients are unknown, as age hides them, so it
+	// cannot be told whether the ciphertext can be reused.
+	smudge()
+	assert.NotEqual(t, ciphertext, clean(t, flt, "app.env", "TOKEN=secret\n"))
+
+	// Unless they are recorded for that very ciphertext.
+	set, err := gitage.ReadRecipientSet(f, fstest.Rootify("/repo"))
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(ciphertext)
+	manifest := fmt.Sprintf("%s %s app.env\n", hex.EncodeToString(sum[:]), set.Fingerprint())
+	require.NoError(t, util.WriteFile(f, fstest.Rootify("/repo/.gitage/manifest"), []byte(manifest), 0o644))
+
+	smudge()
+	assert.Equal(t, ciphertext, clean(t, flt, "app.env", "TOKEN=secret\n"))
+}
+
+// newFilterFS returns a file system with a repository at /repo,
+// with the given identities registered in the default group,
+// and in the ops group, for the files in prod/, respectively.
+func newFilterFS(t *testing.T, dflt, ops *age.X25519Identity) billy.Filesystem {
+	t.Helper()
+
+	f, err := fstest.FsFromArchive(fstest.ParseArchive([]byte(strings.Join([]string{
+		"-- /repo/ --",
+		"-- /repo/.gitage/ --",
+		"-- /repo/.gitage/config --",
+		"-- /repo/.gitage/groups/ --",
+		"-- /repo/.gitage/groups/ops --",
+		ops.Recipient().String(),
+		"-- /repo/.gitage/recipients --",
+		dflt.Recipient().String(),
+		"-- /repo/.gitageattributes --",
+		"prod/** group=ops",
+		"",
+	}, "\n"))))
+	require.NoError(t, err)
+
+	return f
+}
+
+func newFilter(t *testing.T, f billy.Filesystem, identities ...age.Identity) *gitage.Filter {
+	t.Helper()
+
+	flt, err := gitage.NewFilter(f, fstest.Rootify("/repo"), identities...)
+	require.NoError(t, err)
+
+	return flt
+}
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	return identity
+}
+
+func clean(t *testing.T, flt *gitage.Filter, name, plaintext string) []byte {
+	t.Helper()
+
+	out := new(bytes.Buffer)
+	require.NoError(t, flt.Clean(context.Background(), name, out, strings.NewReader(plaintext)))
+
+	return out.Bytes()
+}
+
+func decrypt(t *testing.T, ciphertext []byte, identity age.Identity) string {
+	t.Helper()
+
+	plaintext, err := gitage.Decrypt(context.Background(), ciphertext, identity)
+	require.NoError(t, err)
+
+	return string(plaintext)
+}
+
+func assertNoMatch(t *testing.T, ciphertext []byte, identity age.Identity) {
+	t.Helper()
+
+	_, err := gitage.Decrypt(context.Background(), ciphertext, identity)
+	assert.ErrorIs(t, err, gitage.ErrNoMatchingIdentity)
+}
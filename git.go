@@ -0,0 +1,32 @@
+package gitage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// openGitRepository opens the Git repository at the root
+// of a Gitage repository, as set up by Init.
+func openGitRepository(f billy.Filesystem, root string) (*git.Repository, error) {
+	wt, err := f.Chroot(root)
+	if err != nil {
+		return nil, err
+	}
+
+	dot, err := wt.Chroot(git.GitDirName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := git.Open(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), wt)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("%s: %w", root, err)
+	}
+
+	return r, err
+}
@@ -0,0 +1,229 @@
+package gitage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+)
+
+// groupsDirName is the name of the directory, within the
+// .gitage directory, that holds the recipients of each group
+// of recipients (see Rules.Group), in a file named after it,
+// with the same format as the .gitage/recipients file.
+const groupsDirName = "groups"
+
+var groupNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateGroup checks that the given name can be used as
+// the name of a group, which is also the name of its file.
+func validateGroup(name string) error {
+	if !groupNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid group name %q (expected letters, digits, '.', '_' and '-')", name)
+	}
+
+	return nil
+}
+
+// groupRecipientsPath returns the path of the file that holds the
+// recipients of the given group, of the repository at the given root,
+// which is the .gitage/recipients file for the default group ("").
+func groupRecipientsPath(root, group string) string {
+	if len(group) == 0 {
+		return recipientsPath(root)
+	}
+
+	return filepath.Join(dir(root), groupsDirName, group)
+}
+
+// ReadGroupRecipientSet is like ReadRecipientSet, but it reads the
+// recipients of the given group (see Rules.Group), where the empty
+// one is the default group (the .gitage/recipients file).
+//
+// Arguments:
+// - path: must be an absolute path.
+func ReadGroupRecipientSet(f billy.Filesystem, path, group string) (*RecipientSet, error) {
+	if len(group) > 0 {
+		if err := validateGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return readRecipientSet(f, groupRecipientsPath(root, group))
+}
+
+// ReadGroupRecipients is like ReadRecipients, but it reads and parses
+// the recipients of the given group (see Rules.Group), where the empty
+// one is the default group (the .gitage/recipients file).
+//
+// Arguments:
+// - path: must be an absolute path.
+func ReadGroupRecipients(f billy.Filesystem, path, group string) ([]age.Recipient, error) {
+	if len(group) > 0 {
+		if err := validateGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return readGroupRecipients(f, root, group)
+}
+
+func readGroupRecipients(f billy.Filesystem, root, group string) ([]age.Recipient, error) {
+	recipientsFilepath := groupRecipientsPath(root, group)
+
+	set, err := readRecipientSet(f, recipientsFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := set.Recipients()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", recipientsFilepath, err)
+	}
+
+	return recipients, nil
+}
+
+// fileRecipients are the recipients a file is encrypted to.
+type fileRecipients struct {
+	recipients []age.Recipient
+
+	// fingerprint identifies the recipients, when they are the
+	// registered ones (see RecipientSet), or is empty otherwise
+	// (e.g. given explicitly), so they are never cached (see blobCache).
+	fingerprint string
+}
+
+type recipientsKey struct{}
+
+// WithRecipients returns a copy of the given context that makes
+// encryption operations (e.g. EncryptAll) encrypt files to the given
+// recipients too, besides the ones registered in the group of each
+// file (see Rules.Group), unlike the recipients given to them, which
+// replace the registered ones.
+func WithRecipients(ctx context.Context, recipients ...age.Recipient) context.Context {
+	return context.WithValue(ctx, recipientsKey{}, recipients)
+}
+
+func recipientsFrom(ctx context.Context) []age.Recipient {
+	recipients, _ := ctx.Value(recipientsKey{}).([]age.Recipient)
+	return recipients
+}
+
+// recipientsResolver returns the recipients to encrypt each file
+// to, which are either the ones given explicitly, for every file,
+// or the ones registered in the group of each file (see Rules.Group),
+// plus the additional ones, if any (see WithRecipients).
+//
+// The recipients of each group are loaded once, when first needed,
+// so it is not safe for concurrent use.
+type recipientsResolver struct {
+	f          billy.Filesystem
+	root       string
+	rules      *Rules
+	explicit   []age.Recipient
+	additional []age.Recipient
+	groups     map[string]fileRecipients
+}
+
+// newRecipientsResolver returns a resolver for the repository the given
+// configuration was loaded from, which must be a repository unless some
+// recipients are given explicitly.
+func newRecipientsResolver(f billy.Filesystem, cfg *Config, rules *Rules, explicit ...age.Recipient) (*recipientsResolver, error) {
+	if len(explicit) > 0 {
+		if err := checkRecipients(explicit...); err != nil {
+			return nil, err
+		}
+	} else if len(cfg.root) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoRecipients, ErrNotARepository)
+	}
+
+	return &recipientsResolver{
+		f:        f,
+		root:     cfg.root,
+		rules:    rules,
+		explicit: explicit,
+		groups:   make(map[string]fileRecipients),
+	}, nil
+}
+
+// forFile returns the recipients to encrypt the (plain) file at the given path to.
+func (r *recipientsResolver) forFile(path string) (fileRecipients, error) {
+	if len(r.explicit) > 0 {
+		return fileRecipients{recipients: r.explicit}, nil
+	}
+
+	return r.forGroup(r.rules.Group(path))
+}
+
+// forGroup returns the recipients registered in the given group,
+// where the empty one is the default group, unless some recipients
+// were given explicitly, in which case those are returned instead.
+func (r *recipientsResolver) forGroup(group string) (fileRecipients, error) {
+	if len(r.explicit) > 0 {
+		return fileRecipients{recipients: r.explicit}, nil
+	}
+
+	if resolved, ok := r.groups[group]; ok {
+		return resolved, nil
+	}
+
+	resolved, err := r.load(group)
+	if err != nil {
+		if len(group) > 0 {
+			return fileRecipients{}, fmt.Errorf("group %q: %w", group, err)
+		}
+		return fileRecipients{}, err
+	}
+
+	// Additional recipients are not registered, so the files
+	// encrypted to them are never cached (see fileRecipients).
+	if len(r.additional) > 0 {
+		recipients := append(resolved.recipients[:len(resolved.recipients):len(resolved.recipients)], r.additional...)
+		resolved = fileRecipients{recipients: recipients}
+	}
+
+	if len(resolved.recipients) == 0 {
+		if len(group) == 0 {
+			return fileRecipients{}, ErrNoRecipients
+		}
+		return fileRecipients{}, fmt.Errorf("%w in group %q", ErrNoRecipients, group)
+	}
+
+	if err := checkRecipients(resolved.recipients...); err != nil {
+		return fileRecipients{}, err
+	}
+
+	r.groups[group] = resolved
+
+	return resolved, nil
+}
+
+func (r *recipientsResolver) load(group string) (fileRecipients, error) {
+	recipientsFilepath := groupRecipientsPath(r.root, group)
+
+	set, err := readRecipientSet(r.f, recipientsFilepath)
+	if err != nil {
+		return fileRecipients{}, err
+	}
+
+	recipients, err := set.Recipients()
+	if err != nil {
+		return fileRecipients{}, fmt.Errorf("%s: %w", recipientsFilepath, err)
+	}
+
+	return fileRecipients{recipients: recipients, fingerprint: set.Fingerprint()}, nil
+}
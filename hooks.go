@@ -0,0 +1,75 @@
+package gitage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// Hooks installed by Repository.InstallHooks.
+const (
+	HookPreCommit = "pre-commit"
+	HookPrePush   = "pre-push"
+)
+
+// hookMarker identifies the Git hooks written by InstallHooks,
+// so they can be overwritten, unlike any other existing hook.
+const hookMarker = "# Installed by 'gitage hooks install'."
+
+// hookScripts are the scripts of the Git hooks, which call
+// back into Gitage (see CheckStaged and CheckCommits).
+var hookScripts = map[string]string{
+	HookPreCommit: "#!/bin/sh\n" + hookMarker + "\n" +
+		"# Blocks committing files meant to be encrypted that are not.\n" +
+		"exec gitage hooks run pre-commit\n",
+	HookPrePush: "#!/bin/sh\n" + hookMarker + "\n" +
+		"# Blocks pushing commits with files meant to be encrypted that are not.\n" +
+		"exec gitage hooks run pre-push \"$@\"\n",
+}
+
+// InstallHooks writes the pre-commit and pre-push Git hooks into
+// the Git repository of the repository, which block committing and
+// pushing files that are meant to be encrypted, but that are not.
+//
+// Existing hooks are never overwritten, unless they were written
+// by InstallHooks or overwrite is true, in which case none is.
+func (r *Repository) InstallHooks(_ context.Context, overwrite bool) error {
+	// Hooks are only run for Git repositories.
+	if _, err := openGitRepository(r.f, r.root); err != nil {
+		return err
+	}
+
+	hooksDir := filepath.Join(r.root, git.GitDirName, "hooks")
+	hooks := []string{HookPreCommit, HookPrePush}
+
+	for _, hook := range hooks {
+		hookPath := filepath.Join(hooksDir, hook)
+
+		contents, err := fs.Read(r.f, hookPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err == nil && !overwrite && !bytes.Contains(contents, []byte(hookMarker)) {
+			return fmt.Errorf("%s already exists (overwrite it or add 'gitage hooks run %s' to it)", hookPath, hook)
+		}
+	}
+
+	if err := r.f.MkdirAll(hooksDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if err := fs.WriteFile(r.f, filepath.Join(hooksDir, hook), []byte(hookScripts[hook]), 0o755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+	"github.com/go-git/go-billy/v5"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// Passphrase returns the passphrase of an encrypted key,
+// (e.g. by prompting the user for it), described by the
+// given name (e.g. the path of the file holding the key).
+type Passphrase func(name string) ([]byte, error)
+
+// ReadIdentities reads and parses the identities from the file at
+// the given path, which is either an age identity file, with one
+// identity per line (like the ones written by GenerateIdentity, or
+// by age plugins, e.g. AGE-PLUGIN-YUBIKEY-1...), or an SSH private
+// key, in PEM format (e.g. ~/.ssh/id_ed25519).
+//
+// Encrypted SSH private keys are decrypted with the given passphrase,
+// only when they are used. Their public key is read from the matching
+// .pub file if the private key does not include it.
+//
+// Arguments:
+// - path: must be an absolute path.
+func ReadIdentities(f billy.Filesystem, path string, passphrase Passphrase) ([]age.Identity, error) {
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN")) {
+		identities, err := parseIdentities(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return identities, nil
+	}
+
+	identity, err := readSSHIdentity(f, path, contents, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return []age.Identity{identity}, nil
+}
+
+// parseIdentities is like age.ParseIdentities, but it also
+// supports plugin identities, which are handled by the
+// age-plugin-<name> binary, looked up in the $PATH.
+func parseIdentities(r io.Reader) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		identity, err := parseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("error at line %d: %w", n, err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(identities) == 0 {
+		return nil, errors.New("no secret keys found")
+	}
+
+	return identities, nil
+}
+
+func parseIdentity(s string) (age.Identity, error) {
+	if !isPluginIdentity(s) {
+		return age.ParseX25519Identity(s)
+	}
+
+	identity, err := plugin.NewIdentity(s, pluginUI)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plugins may interact with the user (e.g. to ask for a PIN),
+	// which must not happen for multiple files at the same time.
+	return &syncIdentity{Identity: identity}, nil
+}
+
+func readSSHIdentity(f billy.Filesystem, path string, pemBytes []byte, passphrase Passphrase) (age.Identity, error) {
+	identity, err := agessh.ParseIdentity(pemBytes)
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return identity, err
+	}
+
+	pubKey := missing.PublicKey
+	if pubKey == nil {
+		contents, err := fs.Read(f, path+".pub")
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("encrypted SSH key with no public key (%s.pub not found)", path)
+			}
+			return nil, err
+		}
+
+		pubKey, _, _, _, err = ssh.ParseAuthorizedKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("%s.pub: %w", path, err)
+		}
+	}
+
+	if passphrase == nil {
+		passphrase = func(string) ([]byte, error) {
+			return nil, errors.New("encrypted SSH key, but no passphrase available")
+		}
+	}
+
+	identity, err = agessh.NewEncryptedSSHIdentity(pubKey, pemBytes, func() ([]byte, error) {
+		return passphrase(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncIdentity{Identity: identity}, nil
+}
+
+// syncIdentity serializes the calls to an identity, so it can be used
+// concurrently (see WithJobs). Encrypted SSH identities need it, as they
+// ask for the passphrase and decrypt the key on their first use, and so
+// do plugin identities, as they may interact with the user.
+type syncIdentity struct {
+	age.Identity
+	mu sync.Mutex
+}
+
+func (i *syncIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.Identity.Unwrap(stanzas)
+}
@@ -3,6 +3,7 @@ package gitage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -18,52 +19,54 @@ import (
 
 // Init docs (TODO)
 // - path MUST be an absolute path.
+//
+// Deprecated: use InitRepository instead, which
+// does not print its progress.
 func Init(ctx context.Context, f billy.Filesystem, path string, recipients ...string) error {
+	log.For(ctx).Printf("Creating %s directory...\n", dir(path))
+
+	if _, err := InitRepository(ctx, f, path, recipients...); err != nil {
+		return err
+	}
+
+	log.For(ctx).Println("Gitage repository initialized with success!")
+
+	return nil
+}
+
+// initRepository creates the .gitage directory at the given path,
+// with the default configuration and the given recipients, and
+// initializes a Git repository there, unless there is one already.
+func initRepository(f billy.Filesystem, path string, recipients ...string) error {
 	gitageDir := dir(path)
 	info, err := f.Stat(gitageDir)
 	if err == nil {
 		if !info.IsDir() {
-			log.For(ctx).Printf(`%s already exists as a file...
-Please, remove it and try again.`, gitageDir)
-			return nil
-		}
-
-		if info.IsDir() {
-			log.For(ctx).Printf("%s already exists...\nAre you in a Gitage repository already?\n", gitageDir)
-			return nil
+			return fmt.Errorf("%s already exists as a file (remove it and try again)", gitageDir)
 		}
+		return fmt.Errorf("%w: %s already exists", ErrAlreadyInitialized, gitageDir)
 	}
 
-	if err != nil && !os.IsNotExist(err) {
+	if !os.IsNotExist(err) {
 		return err
 	}
 
-	log.For(ctx).Printf("Creating %s directory...\n", gitageDir)
-
 	if err := fs.Mkdir(f, gitageDir); err != nil {
 		return err
 	}
 
-	if err := initGitRepository(ctx, f, path); err != nil {
-		return err
-	}
-
-	if err := fs.Create(f, filepath.Join(gitageDir, "config"), nil); err != nil {
+	if err := initGitRepository(f, path); err != nil {
 		return err
 	}
 
-	if err := fs.Create(f, filepath.Join(gitageDir, "recipients"), recipientsBytes(recipients...)); err != nil {
+	if err := fs.Create(f, filepath.Join(gitageDir, "config"), []byte(defaultConfig)); err != nil {
 		return err
 	}
 
-	log.For(ctx).Println("Gitage repository initialized with success!")
-
-	return nil
+	return fs.Create(f, filepath.Join(gitageDir, "recipients"), recipientsBytes(recipients...))
 }
 
-func initGitRepository(ctx context.Context, f billy.Filesystem, path string) error {
-	log.For(ctx).Printf("Initializing Git repository at %s...\n", path)
-
+func initGitRepository(f billy.Filesystem, path string) error {
 	root, err := f.Chroot(path)
 	if err != nil {
 		return err
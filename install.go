@@ -0,0 +1,160 @@
+package gitage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/config"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// FilterDriver is the name of the Git filter driver
+// set up by Repository.Install, as referenced from .gitattributes.
+const FilterDriver = "gitage"
+
+// Markers of the block of the .gitattributes
+// file that is managed by Install.
+const (
+	attributesBegin = "# BEGIN gitage (managed by 'gitage install', do not edit)"
+	attributesEnd   = "# END gitage"
+)
+
+// filterOptions are the settings of the filter driver
+// in the Git configuration, where the commands are the
+// ones Git runs to clean and smudge files (see Filter),
+// with the name of the file (%f), to tell its group.
+var filterOptions = [][2]string{
+	{"clean", "gitage filter clean %f"},
+	{"smudge", "gitage filter smudge %f"},
+	{"process", "gitage filter process"},
+	{"required", "true"},
+}
+
+// Install sets up the repository to be encrypted by Git itself,
+// through a filter driver (see Filter), so the working tree holds
+// plain files, while the Git object store only holds encrypted ones:
+//   - The .gitattributes file gets a block that applies the filter
+//     to the files that match the rules of the repository (see Rules),
+//     which is rewritten every time Install is run.
+//   - The Git configuration (.git/config) gets the filter driver.
+func (r *Repository) Install(_ context.Context) error {
+	rules, err := loadRules(r.f, r.cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := installAttributes(r.f, filepath.Join(r.root, ".gitattributes"), rules); err != nil {
+		return err
+	}
+
+	return installFilterDriver(r.f, filepath.Join(r.root, git.GitDirName, "config"))
+}
+
+func installAttributes(f billy.Filesystem, path string, rules *Rules) error {
+	contents, err := fs.Read(f, path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Everything but the managed block is kept as is.
+	var lines []string
+	managed := false
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		switch {
+		case strings.TrimSpace(line) == attributesBegin:
+			managed = true
+		case strings.TrimSpace(line) == attributesEnd && managed:
+			managed = false
+		case !managed && len(line) > 0:
+			lines = append(lines, line)
+		}
+	}
+
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += "\n"
+	}
+
+	buf := bytes.NewBufferString(strings.Join(lines, ""))
+	buf.WriteString(attributesBegin + "\n")
+	for _, line := range rules.attributes() {
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString(attributesEnd + "\n")
+
+	return fs.WriteFile(f, path, buf.Bytes(), 0o644)
+}
+
+// attributes returns the .gitattributes lines that apply
+// the filter driver to the files that match the rules.
+func (r *Rules) attributes() []string {
+	var lines []string
+
+	filter := "filter=" + FilterDriver
+
+	if !r.hasInclude() {
+		lines = append(lines, "* "+filter)
+	}
+
+	for _, rule := range r.rules {
+		// Unlike .gitignore files, .gitattributes files do
+		// not match directories, but the files below them.
+		pattern := rule.pattern
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+
+		if rule.encrypt {
+			lines = append(lines, pattern+" "+filter)
+		} else {
+			lines = append(lines, pattern+" -filter")
+		}
+	}
+
+	// Git and Gitage metadata are never encrypted.
+	names := make([]string, 0, len(metadataFiles))
+	for name := range metadataFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range append([]string{dirName + "/**"}, names...) {
+		lines = append(lines, name+" -filter")
+	}
+
+	return lines
+}
+
+func installFilterDriver(f billy.Filesystem, path string) error {
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: not a Git repository (run 'git init' first)", filepath.Dir(filepath.Dir(path)))
+		}
+		return err
+	}
+
+	cfg := config.New()
+	if err := config.NewDecoder(bytes.NewReader(contents)).Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	sub := cfg.Section("filter").Subsection(FilterDriver)
+	for _, opt := range filterOptions {
+		sub.SetOption(opt[0], opt[1])
+	}
+
+	buf := new(bytes.Buffer)
+	if err := config.NewEncoder(buf).Encode(cfg); err != nil {
+		return err
+	}
+
+	return fs.WriteFile(f, path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Device returns the identifier of the device (file system)
+// the file described by the given info is on, if known, which
+// is only when it comes from the OS file system.
+func Device(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Dev), true
+}
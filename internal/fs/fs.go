@@ -86,15 +86,41 @@ func WriteFile(fs billy.Filesystem, filename string, data []byte, perm os.FileMo
 	return err
 }
 
-func Walk(fs billy.Filesystem, root string, walkFn filepath.WalkFunc) error {
+// SkipPolicy reports whether the given path must be skipped
+// while walking a file tree. When the path is a directory,
+// the whole directory is skipped, without reading it.
+type SkipPolicy func(path string, info os.FileInfo) bool
+
+// Walk walks the file tree rooted at root, calling walkFn for
+// each file or directory in the tree, including root, in lexical
+// order, like filepath.Walk does.
+//
+// Paths reported by any of the given skip policies are not
+// passed to walkFn, and directories are not walked into.
+func Walk(fs billy.Filesystem, root string, walkFn filepath.WalkFunc, skip ...SkipPolicy) error {
 	info, err := fs.Lstat(root)
 	if err != nil {
 		return walkFn(root, nil, err)
 	}
-	return walk(fs, root, info, walkFn)
+
+	if skipped(root, info, skip...) {
+		return nil
+	}
+
+	return walk(fs, root, info, walkFn, skip...)
 }
 
-func walk(fs billy.Filesystem, path string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+func skipped(path string, info os.FileInfo, skip ...SkipPolicy) bool {
+	for _, s := range skip {
+		if s(path, info) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func walk(fs billy.Filesystem, path string, info os.FileInfo, walkFn filepath.WalkFunc, skip ...SkipPolicy) error {
 	err := walkFn(path, info, nil)
 	if err != nil {
 		if info.IsDir() && err == filepath.SkipDir {
@@ -120,7 +146,11 @@ func walk(fs billy.Filesystem, path string, info os.FileInfo, walkFn filepath.Wa
 				return err
 			}
 		} else {
-			err = walk(fs, filename, fileInfo, walkFn)
+			if skipped(filename, fileInfo, skip...) {
+				continue
+			}
+
+			err = walk(fs, filename, fileInfo, walkFn, skip...)
 			if err != nil {
 				if !fileInfo.IsDir() || err != filepath.SkipDir {
 					return err
@@ -0,0 +1,183 @@
+package fs
+
+import (
+	"os"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+)
+
+// Synchronized returns a file-system that can be used concurrently,
+// which is the given one if it is already safe for concurrent use
+// (i.e. osfs), or one that wraps it otherwise (e.g. memfs), by
+// serializing the calls to it and to the files opened through it.
+func Synchronized(fs billy.Filesystem) billy.Filesystem {
+	if _, ok := fs.(*syncFs); ok || isConcurrent(fs) {
+		return fs
+	}
+
+	return &syncFs{fs: fs, mu: new(sync.Mutex)}
+}
+
+// isConcurrent reports whether the given file-system, or the
+// one it wraps (e.g. with chroot), is the one of the OS, which
+// is safe for concurrent use.
+func isConcurrent(fs billy.Basic) bool {
+	for {
+		switch v := fs.(type) {
+		case *osfs.OS:
+			return true
+		case interface{ Underlying() billy.Basic }:
+			fs = v.Underlying()
+		default:
+			return false
+		}
+	}
+}
+
+type syncFs struct {
+	fs billy.Filesystem
+	mu *sync.Mutex
+}
+
+func (s *syncFs) Create(filename string) (billy.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file(s.fs.Create(filename))
+}
+
+func (s *syncFs) Open(filename string) (billy.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file(s.fs.Open(filename))
+}
+
+func (s *syncFs) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file(s.fs.OpenFile(filename, flag, perm))
+}
+
+func (s *syncFs) Stat(filename string) (os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Stat(filename)
+}
+
+func (s *syncFs) Rename(oldpath, newpath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Rename(oldpath, newpath)
+}
+
+func (s *syncFs) Remove(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Remove(filename)
+}
+
+func (s *syncFs) Join(elem ...string) string {
+	return s.fs.Join(elem...)
+}
+
+func (s *syncFs) TempFile(dir, prefix string) (billy.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file(s.fs.TempFile(dir, prefix))
+}
+
+func (s *syncFs) ReadDir(path string) ([]os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.ReadDir(path)
+}
+
+func (s *syncFs) MkdirAll(filename string, perm os.FileMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.MkdirAll(filename, perm)
+}
+
+func (s *syncFs) Lstat(filename string) (os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Lstat(filename)
+}
+
+func (s *syncFs) Symlink(target, link string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Symlink(target, link)
+}
+
+func (s *syncFs) Readlink(link string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fs.Readlink(link)
+}
+
+func (s *syncFs) Chroot(path string) (billy.Filesystem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fs, err := s.fs.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncFs{fs: fs, mu: s.mu}, nil
+}
+
+func (s *syncFs) Root() string {
+	return s.fs.Root()
+}
+
+func (s *syncFs) file(f billy.File, err error) (billy.File, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncFile{File: f, mu: s.mu}, nil
+}
+
+type syncFile struct {
+	billy.File
+	mu *sync.Mutex
+}
+
+func (f *syncFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Write(p)
+}
+
+func (f *syncFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Read(p)
+}
+
+func (f *syncFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.ReadAt(p, off)
+}
+
+func (f *syncFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Seek(offset, whence)
+}
+
+func (f *syncFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Close()
+}
+
+func (f *syncFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.File.Truncate(size)
+}
@@ -0,0 +1,222 @@
+// Package gitfilter implements the filter side of Git's long-running
+// filter process protocol (version 2), as documented in gitattributes(5):
+// https://git-scm.com/docs/gitattributes#_long_running_filter_process
+package gitfilter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+)
+
+// Commands supported by the filter.
+const (
+	Clean  = "clean"
+	Smudge = "smudge"
+)
+
+var (
+	errUnexpectedEOF = errors.New("unexpected end of input")
+	errHandshake     = errors.New("invalid handshake")
+)
+
+// Handler processes a single file, by writing into dst the result
+// of applying the given command (Clean or Smudge) to the contents
+// read from src, which belong to the file at the given pathname.
+type Handler func(command, pathname string, dst io.Writer, src io.Reader) error
+
+// Serve runs the filter side of the protocol, reading requests from r
+// and writing responses to w, until r is exhausted (Git closes the pipe).
+//
+// Files the handler fails to process are reported to Git with the error
+// status, and the handler is called again for the next ones.
+func Serve(r io.Reader, w io.Writer, h Handler) error {
+	s := pktline.NewScanner(r)
+	e := pktline.NewEncoder(w)
+
+	if err := handshake(s, e); err != nil {
+		return err
+	}
+
+	for {
+		headers, err := readList(s)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := serveOne(s, e, headers, h); err != nil {
+			return err
+		}
+	}
+}
+
+func handshake(s *pktline.Scanner, e *pktline.Encoder) error {
+	welcome, err := readList(s)
+	if err != nil {
+		return err
+	}
+
+	if len(welcome) == 0 || welcome[0] != "git-filter-client" || !contains(welcome[1:], "version=2") {
+		return fmt.Errorf("%w: unsupported client or version: %s", errHandshake, strings.Join(welcome, ", "))
+	}
+
+	if err := e.EncodeString("git-filter-server\n", "version=2\n", pktline.FlushString); err != nil {
+		return err
+	}
+
+	capabilities, err := readList(s)
+	if err != nil {
+		return err
+	}
+
+	var supported []string
+	for _, c := range []string{Clean, Smudge} {
+		if contains(capabilities, "capability="+c) {
+			supported = append(supported, "capability="+c+"\n")
+		}
+	}
+
+	return e.EncodeString(append(supported, pktline.FlushString)...)
+}
+
+func serveOne(s *pktline.Scanner, e *pktline.Encoder, headers []string, h Handler) error {
+	var command, pathname string
+	for _, header := range headers {
+		key, value, _ := strings.Cut(header, "=")
+		switch key {
+		case "command":
+			command = value
+		case "pathname":
+			pathname = value
+		}
+	}
+
+	// Git sends the whole contents before reading any response,
+	// so they are read in full first, as otherwise the response
+	// could fill the pipe up, and both sides would be blocked.
+	src := new(bytes.Buffer)
+	if _, err := io.Copy(src, &reader{s: s}); err != nil {
+		return err
+	}
+
+	if command != Clean && command != Smudge {
+		return e.EncodeString("status=error\n", pktline.FlushString)
+	}
+
+	if err := e.EncodeString("status=success\n", pktline.FlushString); err != nil {
+		return err
+	}
+
+	dst := &writer{e: e}
+	herr := h(command, pathname, dst, src)
+
+	if err := e.Flush(); err != nil {
+		return err
+	}
+
+	// An empty list keeps the status sent before the contents.
+	if herr == nil {
+		return e.Flush()
+	}
+
+	return e.EncodeString("status=error\n", pktline.FlushString)
+}
+
+// readList reads a list of text packets, terminated by a flush packet,
+// and returns them without the trailing line break.
+func readList(s *pktline.Scanner) ([]string, error) {
+	var list []string
+
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) == 0 {
+			return list, nil
+		}
+
+		list = append(list, strings.TrimSuffix(string(line), "\n"))
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return nil, errUnexpectedEOF
+	}
+
+	return nil, io.EOF
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reader reads the contents of a file, sent as
+// packets, until the terminating flush packet.
+type reader struct {
+	s    *pktline.Scanner
+	buf  []byte
+	done bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if !r.s.Scan() {
+			if err := r.s.Err(); err != nil {
+				return 0, err
+			}
+			return 0, errUnexpectedEOF
+		}
+
+		r.buf = r.s.Bytes()
+		r.done = len(r.buf) == 0
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// writer writes the contents of a file as packets.
+type writer struct {
+	e *pktline.Encoder
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := len(p)
+		if n > pktline.MaxPayloadSize {
+			n = pktline.MaxPayloadSize
+		}
+
+		if err := w.e.Encode(p[:n]); err != nil {
+			return written, err
+		}
+
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,120 @@
+package gitfilter_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joanlopez/gitage/internal/gitfilter"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("x", 2*pktline.MaxPayloadSize+1)
+
+	// What Git sends: handshake, then one request per file.
+	in := new(bytes.Buffer)
+	e := pktline.NewEncoder(in)
+	require.NoError(t, e.EncodeString("git-filter-client\n", "version=2\n", pktline.FlushString))
+	require.NoError(t, e.EncodeString("capability=clean\n", "capability=smudge\n", "capability=delay\n", pktline.FlushString))
+	request(t, e, "clean", "a.txt", "hello")
+	request(t, e, "smudge", "b.txt", large)
+	request(t, e, "clean", "fail.txt", "boom")
+	request(t, e, "unknown", "c.txt", "ignored")
+
+	out := new(bytes.Buffer)
+	err := gitfilter.Serve(in, out, func(command, pathname string, dst io.Writer, src io.Reader) error {
+		if pathname == "fail.txt" {
+			return errors.New("failed")
+		}
+
+		contents, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write([]byte(command + ":" + string(contents)))
+		return err
+	})
+	require.NoError(t, err)
+
+	// What Git receives.
+	s := pktline.NewScanner(out)
+	assert.Equal(t, []string{"git-filter-server", "version=2"}, list(t, s))
+	assert.Equal(t, []string{"capability=clean", "capability=smudge"}, list(t, s))
+
+	assert.Equal(t, []string{"status=success"}, list(t, s))
+	assert.Equal(t, "clean:hello", contents(t, s))
+	assert.Empty(t, list(t, s))
+
+	assert.Equal(t, []string{"status=success"}, list(t, s))
+	assert.Equal(t, "smudge:"+large, contents(t, s))
+	assert.Empty(t, list(t, s))
+
+	assert.Equal(t, []string{"status=success"}, list(t, s))
+	assert.Empty(t, contents(t, s))
+	assert.Equal(t, []string{"status=error"}, list(t, s))
+
+	assert.Equal(t, []string{"status=error"}, list(t, s))
+
+	assert.False(t, s.Scan(), "Unexpected trailing output")
+}
+
+func TestServe_InvalidHandshake(t *testing.T) {
+	t.Parallel()
+
+	in := new(bytes.Buffer)
+	e := pktline.NewEncoder(in)
+	require.NoError(t, e.EncodeString("git-filter-client\n", "version=1\n", pktline.FlushString))
+
+	err := gitfilter.Serve(in, io.Discard, func(string, string, io.Writer, io.Reader) error { return nil })
+	assert.Error(t, err)
+}
+
+func request(t *testing.T, e *pktline.Encoder, command, pathname, contents string) {
+	t.Helper()
+
+	require.NoError(t, e.EncodeString("command="+command+"\n", "pathname="+pathname+"\n", pktline.FlushString))
+
+	for len(contents) > 0 {
+		n := len(contents)
+		if n > pktline.MaxPayloadSize {
+			n = pktline.MaxPayloadSize
+		}
+		require.NoError(t, e.EncodeString(contents[:n]))
+		contents = contents[n:]
+	}
+
+	require.NoError(t, e.Flush())
+}
+
+func list(t *testing.T, s *pktline.Scanner) []string {
+	t.Helper()
+
+	var l []string
+	for s.Scan() && len(s.Bytes()) > 0 {
+		l = append(l, strings.TrimSuffix(string(s.Bytes()), "\n"))
+	}
+	require.NoError(t, s.Err())
+
+	return l
+}
+
+func contents(t *testing.T, s *pktline.Scanner) string {
+	t.Helper()
+
+	var b strings.Builder
+	for s.Scan() && len(s.Bytes()) > 0 {
+		b.Write(s.Bytes())
+	}
+	require.NoError(t, s.Err())
+
+	return b.String()
+}
@@ -0,0 +1,65 @@
+// Package term provides access to the terminal the process runs in,
+// even when the standard input and output are redirected (e.g. when
+// run from Git), to prompt the user for secrets (e.g. passphrases).
+package term
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/term"
+)
+
+// ReadSecret prints the given prompt to the terminal, and reads
+// a secret from it, with no echo. It fails if there is no terminal.
+func ReadSecret(prompt string) ([]byte, error) {
+	var secret []byte
+
+	err := withTerminal(func(in, out *os.File) error {
+		if _, err := fmt.Fprintf(out, "%s ", prompt); err != nil {
+			return err
+		}
+
+		var err error
+		secret, err = term.ReadPassword(int(in.Fd()))
+
+		// The line break typed is not echoed either.
+		_, _ = fmt.Fprintln(out)
+
+		return err
+	})
+
+	return secret, err
+}
+
+// withTerminal runs fn with the terminal input and output files.
+func withTerminal(fn func(in, out *os.File) error) error {
+	if runtime.GOOS == "windows" {
+		in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		return fn(in, out)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err == nil {
+		defer tty.Close()
+		return fn(tty, tty)
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return fn(os.Stdin, os.Stdin)
+	}
+
+	return fmt.Errorf("standard input is not a terminal, and /dev/tty is not available: %w", err)
+}
@@ -0,0 +1,80 @@
+package gitage
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+type jobsKey struct{}
+
+// WithJobs returns a copy of the given context that makes bulk
+// operations (e.g. EncryptAll) process up to n files in parallel.
+// A value of n lower than one means as many files as CPUs.
+//
+// By default, there are as many jobs as CPUs.
+func WithJobs(ctx context.Context, n int) context.Context {
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+
+	return context.WithValue(ctx, jobsKey{}, n)
+}
+
+func jobsFrom(ctx context.Context) int {
+	if n, ok := ctx.Value(jobsKey{}).(int); ok {
+		return n
+	}
+
+	return runtime.NumCPU()
+}
+
+// parallel calls fn for each index in [0, n), with up to the number
+// of jobs set in the context (see WithJobs) running concurrently.
+//
+// Indexes are dispatched in order, and no more are dispatched once
+// any call fails or the context is cancelled. Calls in flight are
+// not interrupted, so the error returned is always the one of the
+// lowest failing index, like if calls were made one by one.
+func parallel(ctx context.Context, n int, fn func(i int) error) error {
+	errs := make([]error, n)
+
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobsFrom(ctx); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if errs[i] = fn(i); errs[i] != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-stop:
+			break dispatch
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
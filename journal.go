@@ -0,0 +1,411 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// tmpExt is the extension of the temporary files where the
+// result of encrypting or decrypting a file is written to,
+// before being renamed into place.
+const tmpExt = ".tmp-gitage"
+
+// journalCommit is the line written to the journal once
+// all the operations recorded have been prepared.
+const journalCommit = "commit"
+
+// op is a single file operation (e.g. encrypting a file), which
+// is prepared by writing the result into a temporary file (tmp),
+// and committed by renaming it into place (dst) and removing the
+// original file (src), unless it is replaced in place (e.g. when
+// re-keying a file), so the destination is the original file.
+type op struct {
+	tmp, dst, src string
+}
+
+func newOp(src, dst string) op {
+	return op{
+		tmp: filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+tmpExt),
+		dst: dst,
+		src: src,
+	}
+}
+
+// commit renames the temporary file into place and removes
+// the original file. It is idempotent, so it can be retried.
+func (o op) commit(f billy.Filesystem) error {
+	if _, err := f.Stat(o.tmp); err == nil {
+		if err := f.Rename(o.tmp, o.dst); err != nil {
+			return err
+		}
+	}
+
+	// Never remove the original file, unless
+	// the new one has been put in place.
+	if _, err := f.Stat(o.dst); err != nil {
+		return err
+	}
+
+	if o.src == o.dst {
+		return nil
+	}
+
+	if err := f.Remove(o.src); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// stream prepares the operation by writing into the temporary
+// file (tmp) the result of the given function, which reads from
+// the original file (src). The temporary file gets the same
+// permissions as the original one.
+func (o op) stream(f billy.Filesystem, fn func(dst io.Writer, src io.Reader) error) error {
+	info, err := f.Stat(o.src)
+	if err != nil {
+		return err
+	}
+
+	src, err := f.Open(o.src)
+	if err != nil {
+		return err
+	}
+
+	dst, err := f.OpenFile(o.tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		_ = src.Close()
+		return err
+	}
+
+	err = fn(dst, src)
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// run prepares the operation and commits it,
+// or rolls it back if it cannot be prepared.
+func (o op) run(f billy.Filesystem, prepare func(op) error) error {
+	if err := prepare(o); err != nil {
+		if rbErr := o.rollback(f); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %s)", err, rbErr)
+		}
+		return err
+	}
+
+	return o.commit(f)
+}
+
+// rollback removes the temporary file, leaving the
+// original file untouched.
+func (o op) rollback(f billy.Filesystem) error {
+	if err := f.Remove(o.tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// journal records the operations of a multi-file operation
+// (e.g. EncryptAll) in the .gitage/journal file, so if it is
+// interrupted halfway, it can be rolled back, when not all the
+// operations were prepared yet, or forward otherwise.
+//
+// A journal with no path (outside a repository) only keeps
+// the operations in memory.
+//
+// While open, a journal holds the lock of the repository, so
+// no other operation runs on it at the same time, which is
+// released once it is closed.
+type journal struct {
+	f    billy.Filesystem
+	path string
+	lock string
+	ops  []op
+}
+
+func journalPath(root string) string {
+	return filepath.Join(dir(root), "journal")
+}
+
+func lockPath(root string) string {
+	return filepath.Join(dir(root), "lock")
+}
+
+// acquireLock takes the lock of the repository at the given root,
+// by creating the .gitage/lock file, which must not exist, and
+// returns its path, to release it (see releaseLock) afterwards.
+//
+// It returns ErrLocked if the lock is held already.
+func acquireLock(f billy.Filesystem, root string) (string, error) {
+	path := lockPath(root)
+
+	file, err := f.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("%w: %s exists (remove it if no other operation is running)", ErrLocked, path)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return path, file.Close()
+}
+
+// releaseLock releases the lock taken with acquireLock.
+func releaseLock(f billy.Filesystem, path string) error {
+	if err := f.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// openJournal takes the lock of the repository the given
+// configuration was loaded from, if any, recovers from any
+// previously interrupted operation, and starts a new journal.
+func openJournal(ctx context.Context, f billy.Filesystem, cfg *Config) (*journal, error) {
+	j := &journal{f: f}
+
+	if len(cfg.root) == 0 {
+		return j, nil
+	}
+
+	lock, err := acquireLock(f, cfg.root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recoverJournal(ctx, f, cfg.root)
+	if err == nil {
+		j.path = journalPath(cfg.root)
+		err = fs.Create(f, j.path, nil)
+	}
+
+	if err != nil {
+		_ = releaseLock(f, lock)
+		return nil, err
+	}
+
+	j.lock = lock
+
+	return j, nil
+}
+
+// run prepares all the given operations, recording them first
+// in the journal, and commits them once all of them have been
+// prepared. If any of them fails, or the context is cancelled,
+// all of them are rolled back.
+//
+// Operations are prepared concurrently, according to the number
+// of jobs set in the context (see WithJobs), but they are always
+// committed in the given order.
+func (j *journal) run(ctx context.Context, ops []op, prepare func(op) error) error {
+	for _, o := range ops {
+		if err := j.record(o); err != nil {
+			return j.abort(err)
+		}
+	}
+
+	err := parallel(ctx, len(ops), func(i int) error {
+		if err := prepare(ops[i]); err != nil {
+			return fmt.Errorf("%s: %w", ops[i].src, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return j.abort(err)
+	}
+
+	return j.commit()
+}
+
+// record adds the given operation to the journal,
+// before it is prepared.
+func (j *journal) record(o op) error {
+	j.ops = append(j.ops, o)
+
+	if len(j.path) == 0 {
+		return nil
+	}
+
+	return fs.Append(j.f, j.path, []byte(strings.Join([]string{o.tmp, o.dst, o.src}, "\t")+"\n"))
+}
+
+// commit marks the journal as committed, and commits all
+// the operations recorded, removing the journal afterwards.
+func (j *journal) commit() error {
+	if len(j.path) > 0 {
+		if err := fs.Append(j.f, j.path, []byte(journalCommit+"\n")); err != nil {
+			return j.abort(err)
+		}
+	}
+
+	return j.apply()
+}
+
+// apply commits all the operations recorded,
+// removing the journal afterwards.
+func (j *journal) apply() error {
+	for _, o := range j.ops {
+		if err := o.commit(j.f); err != nil {
+			return err
+		}
+	}
+
+	return j.close()
+}
+
+// rollback rolls back all the operations recorded,
+// removing the journal afterwards.
+func (j *journal) rollback() error {
+	for _, o := range j.ops {
+		if err := o.rollback(j.f); err != nil {
+			return err
+		}
+	}
+
+	return j.close()
+}
+
+// abort rolls back all the operations recorded, because
+// of the given error, which is returned (wrapped if the
+// rollback fails as well).
+func (j *journal) abort(err error) error {
+	if rbErr := j.rollback(); rbErr != nil {
+		return fmt.Errorf("%w (rollback failed: %s)", err, rbErr)
+	}
+
+	return err
+}
+
+func (j *journal) close() error {
+	if len(j.path) == 0 {
+		return nil
+	}
+
+	if err := fs.RemoveAll(j.f, j.path); err != nil {
+		return err
+	}
+
+	if len(j.lock) == 0 {
+		return nil
+	}
+
+	return releaseLock(j.f, j.lock)
+}
+
+// Recover completes or reverts any multi-file operation (e.g. EncryptAll)
+// that was interrupted halfway in the repository, according to the
+// .gitage/journal file, as the package-level Recover does.
+func (r *Repository) Recover(ctx context.Context) error {
+	return lockedRecover(ctx, r.f, r.root)
+}
+
+// Recover completes or reverts any multi-file operation (e.g. EncryptAll)
+// that was interrupted halfway in the Gitage repository that contains the
+// given path, according to the .gitage/journal file.
+//
+// If all the files were already encrypted (or decrypted), the operation is
+// completed. Otherwise, it is reverted, leaving the original files untouched.
+//
+// It only recovers while holding the lock of the repository (the .gitage/lock
+// file), as the operation may still be running otherwise, so it returns
+// ErrLocked if the lock is held already.
+//
+// It is called automatically by EncryptAll and DecryptAll.
+//
+// Arguments:
+// - path: must be an absolute path.
+func Recover(ctx context.Context, f billy.Filesystem, path string) error {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return err
+	}
+
+	return lockedRecover(ctx, f, root)
+}
+
+// lockedRecover recovers from any interrupted operation
+// (see recoverJournal) while holding the lock.
+func lockedRecover(ctx context.Context, f billy.Filesystem, root string) error {
+	lock, err := acquireLock(f, root)
+	if err != nil {
+		return err
+	}
+
+	err = recoverJournal(ctx, f, root)
+
+	if relErr := releaseLock(f, lock); err == nil {
+		err = relErr
+	}
+
+	return err
+}
+
+// recoverJournal completes or reverts the operation recorded
+// in the journal, if any, so the lock must be held by the caller.
+func recoverJournal(_ context.Context, f billy.Filesystem, root string) error {
+	path := journalPath(root)
+
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// A trailing line with no line break is an entry that was
+	// not fully recorded, so its operation was never prepared.
+	if i := bytes.LastIndexByte(contents, '\n'); i != len(contents)-1 {
+		contents = contents[:i+1]
+	}
+
+	j := &journal{f: f, path: path}
+	committed := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == journalCommit {
+			committed = true
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return fmt.Errorf("%s: line %d: malformed journal entry", path, n)
+		}
+
+		j.ops = append(j.ops, op{tmp: fields[0], dst: fields[1], src: fields[2]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if committed {
+		return j.apply()
+	}
+
+	return j.rollback()
+}
@@ -0,0 +1,56 @@
+package gitage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+)
+
+// GenerateIdentity generates a new X25519 identity, and writes it
+// into a new file at the given path, only readable by its owner,
+// in the same format age-keygen does:
+//
+//	# created: 2023-01-02T18:54:12+01:00
+//	# public key: age1xkt49yr0y689x45qqrja6rgl0sne82gw5gt6mhhepa7xm7r6myfsd63983
+//	AGE-SECRET-KEY-1...
+//
+// It never overwrites an existing file. The parent directories are
+// created if needed.
+//
+// Arguments:
+// - path: must be an absolute path.
+func GenerateIdentity(f billy.Filesystem, path string) (*age.X25519Identity, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	file, err := f.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%s already exists (refusing to overwrite it)", path)
+		}
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(file, "# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), identity.Recipient(), identity)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,221 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// manifestHeader is the first line of the .gitage/manifest file.
+const manifestHeader = "# Recipients of each encrypted file (managed by gitage, do not edit)"
+
+// manifest records, for each encrypted file of the repository, the
+// fingerprint of the recipients it was encrypted to (see RecipientSet),
+// as age hides them, along with the hash of its ciphertext, so a record
+// only holds for the very file it was made for. It is stored in the
+// .gitage/manifest file, which is committed, like the recipients, one
+// file per line:
+//
+//	<ciphertext hash> <recipients fingerprint> <path>
+type manifest struct {
+	entries map[string]manifestEntry
+}
+
+type manifestEntry struct {
+	sum         string
+	fingerprint string
+}
+
+// manifestPath returns the path of the .gitage/manifest
+// file of the Gitage repository at the given root.
+func manifestPath(root string) string {
+	return filepath.Join(dir(root), "manifest")
+}
+
+// readManifest reads the manifest of the repository at the
+// given root, which is empty if there is no manifest yet.
+func readManifest(f billy.Filesystem, root string) (*manifest, error) {
+	m := &manifest{entries: make(map[string]manifestEntry)}
+
+	path := manifestPath(root)
+
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The path goes last, as it may contain spaces.
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s: line %d: malformed entry", path, n)
+		}
+
+		m.entries[fields[2]] = manifestEntry{sum: fields[0], fingerprint: fields[1]}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// record records that the encrypted file at the given path is encrypted
+// to the recipients with the given fingerprint, which is empty when they
+// are not the registered ones (e.g. given explicitly), in which case any
+// previous record of the file is removed.
+func (m *manifest) record(f billy.Filesystem, root, path, fingerprint string) error {
+	name := relSlash(root, path)
+
+	if len(fingerprint) == 0 {
+		delete(m.entries, name)
+		return nil
+	}
+
+	sum, err := fileSum(f, path)
+	if err != nil {
+		return err
+	}
+
+	m.entries[name] = manifestEntry{sum: sum, fingerprint: fingerprint}
+
+	return nil
+}
+
+// lookup returns the fingerprint of the recipients the encrypted file
+// at the given path is encrypted to, if recorded, and if the record is
+// for its current contents, which it reports along.
+func (m *manifest) lookup(f billy.Filesystem, root, path string) (string, bool, error) {
+	entry, ok := m.entries[relSlash(root, path)]
+	if !ok {
+		return "", false, nil
+	}
+
+	sum, err := fileSum(f, path)
+	if err != nil {
+		return "", false, err
+	}
+
+	return entry.fingerprint, sum == entry.sum, nil
+}
+
+// recorded returns the fingerprint of the recipients the encrypted file
+// at the given path is encrypted to, only if recorded for its current
+// contents (see lookup), or empty otherwise, as well as for a nil manifest.
+func (m *manifest) recorded(f billy.Filesystem, root, path string) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+
+	fingerprint, current, err := m.lookup(f, root, path)
+	if err != nil || !current {
+		return "", err
+	}
+
+	return fingerprint, nil
+}
+
+// recordedFor is like recorded, but for the encrypted file with the
+// given name (relative to the root, and slash-separated), and the
+// ciphertext with the given hash (hex-encoded SHA-256).
+func (m *manifest) recordedFor(name, sum string) string {
+	if m == nil {
+		return ""
+	}
+
+	entry, ok := m.entries[name]
+	if !ok || entry.sum != sum {
+		return ""
+	}
+
+	return entry.fingerprint
+}
+
+// write writes the manifest back to the repository at the given root.
+func (m *manifest) write(f billy.Filesystem, root string) error {
+	names := make([]string, 0, len(m.entries))
+	for name := range m.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString(manifestHeader + "\n")
+	for _, name := range names {
+		entry := m.entries[name]
+		buf.WriteString(entry.sum + " " + entry.fingerprint + " " + name + "\n")
+	}
+
+	return fs.Create(f, manifestPath(root), buf.Bytes())
+}
+
+// recordRecipients records, in the manifest of the repository at the
+// given root, the fingerprint of the recipients each of the given
+// encrypted files (by path) is encrypted to (see manifest).
+func recordRecipients(f billy.Filesystem, root string, fingerprints map[string]string) error {
+	if len(root) == 0 || len(fingerprints) == 0 {
+		return nil
+	}
+
+	m, err := readManifest(f, root)
+	if err != nil {
+		return err
+	}
+
+	for path, fingerprint := range fingerprints {
+		if err := m.record(f, root, path, fingerprint); err != nil {
+			return err
+		}
+	}
+
+	return m.write(f, root)
+}
+
+// fileSum returns the SHA-256 hash of the
+// file at the given path, hex-encoded.
+func fileSum(f billy.Filesystem, path string) (string, error) {
+	file, err := f.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// relSlash returns the given path relative to the
+// given root, with forward slashes.
+func relSlash(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,258 @@
+package gitage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// target is a path resolved from the ones given to
+// EncryptPaths or DecryptPaths (see Repository.resolve).
+type target struct {
+	path string
+	dir  bool
+
+	// matched is whether the path was matched by a glob
+	// pattern, rather than given explicitly.
+	matched bool
+}
+
+// EncryptPaths encrypts the files at the given paths, which may
+// also be glob patterns, like 'secrets/*.json' or 'secrets/**/*.env',
+// matched against the files of the repository, relative to its root,
+// as the patterns of the rules are (see Rules), where ** matches any
+// number of directories.
+//
+// Directories are encrypted as EncryptAll does, and files as
+// EncryptFile does, except for the ones already encrypted that
+// are matched by a pattern, which are skipped.
+//
+// Patterns never match the files skipped by EncryptAll (e.g. the Git
+// and Gitage metadata files), and fail if they match nothing at all.
+func (r *Repository) EncryptPaths(ctx context.Context, paths []string, recipients ...age.Recipient) error {
+	targets, err := r.resolve(paths, false)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range targets {
+		switch {
+		case t.dir:
+			err = r.encryptAll(ctx, t.path, recipients...)
+		case t.matched && strings.HasSuffix(t.path, r.cfg.Extension):
+			continue
+		default:
+			err = r.encryptFile(ctx, t.path, recipients...)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecryptPaths decrypts the files at the given paths, which may
+// also be glob patterns, like EncryptPaths does. Both paths and
+// patterns can be given by the names of the plain files (e.g.
+// 'secrets/*.json'), as well as by the ones of the encrypted files.
+//
+// Directories are decrypted as DecryptAll does, and files as
+// DecryptFile does, except for the ones not encrypted that are
+// matched by a pattern, which are skipped.
+func (r *Repository) DecryptPaths(ctx context.Context, paths []string, identities ...age.Identity) error {
+	targets, err := r.resolve(paths, true)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range targets {
+		switch {
+		case t.dir:
+			err = r.decryptAll(ctx, t.path, identities...)
+		case t.matched && !strings.HasSuffix(t.path, r.cfg.Extension):
+			continue
+		default:
+			err = r.decryptFile(ctx, t.path, identities...)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolve resolves the given paths, and expands the glob patterns
+// among them, into the paths to operate on, in the given order, and
+// without duplicates. When resolving the paths to decrypt, the names
+// of the plain files stand for the ones of the encrypted files.
+func (r *Repository) resolve(paths []string, encrypted bool) ([]target, error) {
+	skip, err := skipPolicy(r.f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []target
+	seen := make(map[string]bool)
+
+	add := func(path string, info os.FileInfo, matched bool) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+
+		targets = append(targets, target{path: path, dir: info.IsDir(), matched: matched})
+	}
+
+	for _, arg := range paths {
+		path, err := r.abs(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.isMetadata(path) {
+			return nil, fmt.Errorf("%s is within the Git or Gitage metadata", path)
+		}
+
+		if !hasMeta(arg) {
+			info, err := r.f.Stat(path)
+			if os.IsNotExist(err) && encrypted {
+				path += r.cfg.Extension
+				info, err = r.f.Stat(path)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			add(path, info, false)
+			continue
+		}
+
+		matches, err := r.glob(path, encrypted, skip)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			add(m.path, m.info, true)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", arg)
+		}
+	}
+
+	return targets, nil
+}
+
+// match is a path matched by a glob pattern (see Repository.glob).
+type match struct {
+	path string
+	info os.FileInfo
+}
+
+// glob returns the paths that match the given pattern, which must be
+// an absolute path, walking the files of the repository, in lexical
+// order, from the deepest directory without special characters, as
+// the skip policy does (see skipPolicy). When resolving the paths to
+// decrypt, the names of the plain files stand for the ones of the
+// encrypted files.
+//
+// Patterns are matched like the ones of the rules (see Rules), but
+// always anchored to the root of the repository, as the shell would
+// (e.g. *.json only matches the files at the root). Directories
+// matched are not walked into, as they are operated on as a whole.
+func (r *Repository) glob(pattern string, encrypted bool, skip fs.SkipPolicy) ([]match, error) {
+	rel, err := filepath.Rel(r.root, pattern)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	// The deepest directory without special characters.
+	base := r.root
+	for _, name := range strings.Split(path.Dir(rel), "/") {
+		if hasMeta(name) {
+			break
+		}
+		base = filepath.Join(base, name)
+	}
+
+	patterns := []string{"/" + rel}
+	if encrypted {
+		patterns = append(patterns, "/"+rel+r.cfg.Extension)
+	}
+
+	var matches []match
+
+	err = fs.Walk(r.f, base, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == base {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return err
+		}
+
+		for _, pattern := range patterns {
+			if !matchPattern(pattern, filepath.ToSlash(rel)) {
+				continue
+			}
+
+			matches = append(matches, match{path: path, info: info})
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		return nil
+	}, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// isMetadata reports whether the given path is within
+// the Git or Gitage directory of the repository.
+func (r *Repository) isMetadata(path string) bool {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if name == git.GitDirName || name == dirName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasMeta reports whether the given path contains
+// any of the special characters of glob patterns.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
@@ -0,0 +1,76 @@
+package gitage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age/plugin"
+
+	"github.com/joanlopez/gitage/internal/term"
+)
+
+// pluginUI is how age plugins (e.g. age-plugin-yubikey) interact
+// with the user, through the terminal, while they wrap and unwrap
+// file keys (e.g. to ask for a PIN, or for a hardware token touch).
+//
+// Messages are written to the standard error, as the standard output
+// may be in use (e.g. by the Git filter process).
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		_, err := fmt.Fprintf(os.Stderr, "age-plugin-%s: %s\n", name, message)
+		return err
+	},
+	RequestValue: func(name, prompt string, _ bool) (string, error) {
+		value, err := term.ReadSecret(prompt)
+		if err != nil {
+			return "", fmt.Errorf("could not read value for age-plugin-%s: %w", name, err)
+		}
+		return string(value), nil
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		if no == "" {
+			prompt += fmt.Sprintf(" (press enter for %q)", yes)
+		} else {
+			prompt += fmt.Sprintf(" (type 1 for %q or 2 for %q)", yes, no)
+		}
+
+		for {
+			choice, err := term.ReadSecret(prompt)
+			if err != nil {
+				return false, fmt.Errorf("could not read value for age-plugin-%s: %w", name, err)
+			}
+
+			switch strings.TrimSpace(string(choice)) {
+			case "1":
+				return true, nil
+			case "2":
+				if no != "" {
+					return false, nil
+				}
+			case "":
+				if no == "" {
+					return true, nil
+				}
+			}
+		}
+	},
+	WaitTimer: func(name string) {
+		_, _ = fmt.Fprintf(os.Stderr, "Waiting for age-plugin-%s...\n", name)
+	},
+}
+
+// isPluginRecipient reports whether the given recipient is handled
+// by an age plugin (e.g. age1yubikey1...), rather than by age itself.
+// Their Bech32 prefix includes the plugin name, like age1<name>1...,
+// and '1' is not part of the Bech32 charset, so that is the only way
+// such a recipient can hold more than one.
+func isPluginRecipient(s string) bool {
+	return strings.HasPrefix(s, "age1") && strings.Count(s, "1") > 1
+}
+
+// isPluginIdentity reports whether the given identity is handled
+// by an age plugin (e.g. AGE-PLUGIN-YUBIKEY-1...).
+func isPluginIdentity(s string) bool {
+	return strings.HasPrefix(s, "AGE-PLUGIN-")
+}
@@ -0,0 +1,62 @@
+package gitage
+
+import (
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+	"github.com/go-git/go-billy/v5"
+)
+
+// ParseRecipient parses a single recipient, given in its
+// textual representation, which is either an age public key
+// (e.g. age1...), an SSH public key (ssh-ed25519 or ssh-rsa),
+// in the authorized_keys format (e.g. ~/.ssh/id_ed25519.pub),
+// or an age plugin recipient (e.g. age1yubikey1...).
+//
+// Plugin recipients are handled by the age-plugin-<name> binary,
+// looked up in the $PATH, which is only run when files are encrypted,
+// so they can be parsed (e.g. registered) with no plugin installed.
+func ParseRecipient(s string) (age.Recipient, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "ssh-"):
+		return agessh.ParseRecipient(s)
+	case isPluginRecipient(s):
+		return plugin.NewRecipient(s, pluginUI)
+	}
+
+	return age.ParseX25519Recipient(s)
+}
+
+// ParseRecipients parses a list of recipients, one per line,
+// like the ones stored in the .gitage/recipients file, with
+// their labels, if any (see RecipientEntry).
+//
+// Empty lines and lines starting with '#' are ignored.
+// Invalid entries are reported along with their line number.
+func ParseRecipients(r io.Reader) ([]age.Recipient, error) {
+	set, err := ParseRecipientSet(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return set.Recipients()
+}
+
+// ReadRecipients reads and parses the recipients registered in the
+// Gitage repository that contains the given path, which is looked up
+// by walking up the directory tree until a .gitage directory is found.
+//
+// Arguments:
+// - path: must be an absolute path.
+func ReadRecipients(f billy.Filesystem, path string) ([]age.Recipient, error) {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return readGroupRecipients(f, root, "")
+}
@@ -0,0 +1,384 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// RecipientEntry is a recipient registered in a Gitage repository,
+// as written in the .gitage/recipients file: one per line, with an
+// optional label after a '#', that tells whom the recipient belongs
+// to, like:
+//
+//	age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p # Alice <alice@corp>
+type RecipientEntry struct {
+	// Key is the textual representation of
+	// the recipient (see ParseRecipient).
+	Key string `json:"key"`
+
+	// Label tells whom the recipient belongs to,
+	// usually as a name and an email address.
+	Label string `json:"label,omitempty"`
+
+	// Line is the number of the line of the file the
+	// entry was read from, or zero if it was not read.
+	Line int `json:"line,omitempty"`
+}
+
+// ParseRecipientEntry parses a single entry, given as a line
+// of the .gitage/recipients file. The key of the recipient is
+// not parsed (see RecipientEntry.Recipient).
+func ParseRecipientEntry(s string) (RecipientEntry, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 || strings.HasPrefix(s, "#") {
+		return RecipientEntry{}, errors.New("no recipient found")
+	}
+
+	// The label starts at the first '#' that follows a space, as SSH
+	// public keys (e.g. ssh-ed25519 AAAA... me@host) include spaces.
+	key, label := s, ""
+	if i := strings.Index(s, " #"); i >= 0 {
+		key, label = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+2:])
+	}
+
+	return RecipientEntry{Key: key, Label: label}, nil
+}
+
+// Recipient parses the key of the entry (see ParseRecipient).
+func (e RecipientEntry) Recipient() (age.Recipient, error) {
+	return ParseRecipient(e.Key)
+}
+
+// Name returns the name in the label of the entry, which is
+// the whole label if it does not include an email address.
+func (e RecipientEntry) Name() string {
+	if i := strings.Index(e.Label, "<"); i >= 0 {
+		return strings.TrimSpace(e.Label[:i])
+	}
+
+	return e.Label
+}
+
+// Email returns the email address in the label of the entry,
+// written between angle brackets, if any.
+func (e RecipientEntry) Email() string {
+	i, j := strings.Index(e.Label, "<"), strings.LastIndex(e.Label, ">")
+	if i < 0 || j < i {
+		return ""
+	}
+
+	return strings.TrimSpace(e.Label[i+1 : j])
+}
+
+// Matches reports whether the entry is the given recipient, given
+// either as a key, or as the label, the name or the email address
+// in the label (e.g. alice), which are compared case-insensitively.
+func (e RecipientEntry) Matches(s string) bool {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return false
+	}
+
+	if canonicalKey(e.Key) == canonicalKey(s) {
+		return true
+	}
+
+	for _, label := range []string{e.Label, e.Name(), e.Email()} {
+		if len(label) > 0 && strings.EqualFold(label, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the entry as a line of the .gitage/recipients file.
+func (e RecipientEntry) String() string {
+	if len(e.Label) == 0 {
+		return e.Key
+	}
+
+	return e.Key + " # " + e.Label
+}
+
+// canonicalKey returns the given key with no comment,
+// so the same SSH public key matches, whatever its
+// comment is (e.g. ssh-ed25519 AAAA... me@host).
+func canonicalKey(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) > 2 && strings.HasPrefix(fields[0], "ssh-") {
+		return fields[0] + " " + fields[1]
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// RecipientSet is the set of recipients registered in a Gitage
+// repository, as read from the .gitage/recipients file, which
+// keeps the comments and the empty lines of the file, so it can
+// be written back with only the entries added or removed changed.
+type RecipientSet struct {
+	lines []recipientLine
+}
+
+// recipientLine is a line of the .gitage/recipients
+// file, which either holds an entry, or does not
+// (e.g. comments and empty lines), and is kept as is.
+type recipientLine struct {
+	text  string
+	entry *RecipientEntry
+}
+
+// ParseRecipientSet parses the recipients, one per line, like the
+// ones stored in the .gitage/recipients file (see RecipientEntry).
+//
+// Empty lines and lines starting with '#' are kept, but ignored.
+// The keys of the recipients are not parsed (see Recipients).
+func ParseRecipientSet(r io.Reader) (*RecipientSet, error) {
+	s := new(RecipientSet)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := recipientLine{text: scanner.Text()}
+
+		if entry, err := ParseRecipientEntry(line.text); err == nil {
+			entry.Line = n
+			line.entry = &entry
+		}
+
+		s.lines = append(s.lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ReadRecipientSet reads the recipients registered in the Gitage
+// repository that contains the given path, which is looked up by
+// walking up the directory tree until a .gitage directory is found.
+//
+// Arguments:
+// - path: must be an absolute path.
+func ReadRecipientSet(f billy.Filesystem, path string) (*RecipientSet, error) {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return readRecipientSet(f, recipientsPath(root))
+}
+
+func readRecipientSet(f billy.Filesystem, path string) (*RecipientSet, error) {
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s file not found", path)
+		}
+		return nil, err
+	}
+
+	return ParseRecipientSet(bytes.NewReader(contents))
+}
+
+// recipientsPath returns the path of the .gitage/recipients
+// file of the Gitage repository at the given root.
+func recipientsPath(root string) string {
+	return filepath.Join(dir(root), "recipients")
+}
+
+// Entries returns the entries in the set, in the order they are.
+func (s *RecipientSet) Entries() []RecipientEntry {
+	var entries []RecipientEntry
+	for _, line := range s.lines {
+		if line.entry != nil {
+			entries = append(entries, *line.entry)
+		}
+	}
+
+	return entries
+}
+
+// Recipients parses the keys of the entries in the set.
+// Invalid keys are reported along with their line number.
+func (s *RecipientSet) Recipients() ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, entry := range s.Entries() {
+		recipient, err := entry.Recipient()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", entry.Line, err)
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// Add adds the given entry to the set, unless its key is in the set
+// already, in which case only the label of the entry in the set is
+// set, if it has none. It reports whether the set was changed.
+func (s *RecipientSet) Add(entry RecipientEntry) bool {
+	for i, line := range s.lines {
+		if line.entry == nil || canonicalKey(line.entry.Key) != canonicalKey(entry.Key) {
+			continue
+		}
+
+		if len(line.entry.Label) > 0 || len(entry.Label) == 0 {
+			return false
+		}
+
+		updated := *line.entry
+		updated.Label = entry.Label
+		s.lines[i] = recipientLine{text: updated.String(), entry: &updated}
+
+		return true
+	}
+
+	entry.Line = 0
+	s.lines = append(s.lines, recipientLine{text: entry.String(), entry: &entry})
+
+	return true
+}
+
+// Remove removes the entries that match the given recipient,
+// given either as a key or by its label (see Matches), from
+// the set, and returns them.
+func (s *RecipientSet) Remove(recipient string) []RecipientEntry {
+	var removed []RecipientEntry
+
+	lines := s.lines[:0]
+	for _, line := range s.lines {
+		if line.entry != nil && line.entry.Matches(recipient) {
+			removed = append(removed, *line.entry)
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+	s.lines = lines
+
+	return removed
+}
+
+// Fingerprint returns a fingerprint of the keys in the set, which is
+// the same for the sets with the same keys, no matter their order,
+// labels or comments, so it tells when the recipients changed.
+func (s *RecipientSet) Fingerprint() string {
+	var keys []string
+	for _, entry := range s.Entries() {
+		keys = append(keys, canonicalKey(entry.Key))
+	}
+	sort.Strings(keys)
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Bytes returns the set as the contents of
+// the .gitage/recipients file, one per line.
+func (s *RecipientSet) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, line := range s.lines {
+		buf.WriteString(line.text + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// RecipientInfo describes an entry of a RecipientSet,
+// along with the problems found in it, if any.
+type RecipientInfo struct {
+	RecipientEntry
+
+	// Type is the type of the key of the entry (e.g. x25519,
+	// ssh-ed25519, or plugin:yubikey), or unknown if invalid.
+	Type string `json:"type"`
+
+	// Fingerprint is a short fingerprint of the key, which
+	// is the same for all the entries with the same key.
+	Fingerprint string `json:"fingerprint"`
+
+	// Problems are the problems found in the entry (e.g. it is
+	// invalid, or the same key is registered more than once).
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Inspect describes every entry of the set, in the order they are,
+// and checks them for problems: keys that cannot be parsed, as well
+// as keys that are registered more than once, either with the same
+// label (duplicates), or with a different one.
+func (s *RecipientSet) Inspect() []RecipientInfo {
+	var infos []RecipientInfo
+
+	first := make(map[string]RecipientEntry)
+	for _, entry := range s.Entries() {
+		info := RecipientInfo{
+			RecipientEntry: entry,
+			Type:           "unknown",
+			Fingerprint:    entry.Fingerprint(),
+		}
+
+		recipient, err := entry.Recipient()
+		if err != nil {
+			info.Problems = append(info.Problems, fmt.Sprintf("invalid recipient: %s", err))
+		} else {
+			info.Type = recipientType(recipient)
+		}
+
+		key := canonicalKey(entry.Key)
+		if prev, ok := first[key]; !ok {
+			first[key] = entry
+		} else if prev.Label == entry.Label {
+			info.Problems = append(info.Problems, fmt.Sprintf("duplicate of line %d", prev.Line))
+		} else {
+			info.Problems = append(info.Problems, fmt.Sprintf("same key as line %d, labeled %q", prev.Line, prev.Label))
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// Fingerprint returns a short fingerprint of the key of the entry,
+// made of the first bytes of its SHA-256 hash, so keys (e.g. long
+// SSH ones) can be told apart at a glance.
+func (e RecipientEntry) Fingerprint() string {
+	sum := sha256.Sum256([]byte(canonicalKey(e.Key)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func recipientType(r age.Recipient) string {
+	switch r := r.(type) {
+	case *age.X25519Recipient:
+		return "x25519"
+	case *agessh.Ed25519Recipient:
+		return "ssh-ed25519"
+	case *agessh.RSARecipient:
+		return "ssh-rsa"
+	case *plugin.Recipient:
+		return "plugin:" + r.Name()
+	default:
+		return fmt.Sprintf("%T", r)
+	}
+}
@@ -2,9 +2,8 @@ package gitage
 
 import (
 	"context"
+	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/go-git/go-billy/v5"
 
@@ -14,49 +13,86 @@ import (
 
 // Register docs (TODO)
 // - path MUST be an absolute path.
+// - recipients are entries of the recipients file (see RecipientEntry),
+// so they can be labeled (e.g. age1... # Alice <alice@corp>). Those
+// already registered are not registered twice, but labeled if they
+// were not.
+//
+// Deprecated: use Open and Repository.Register instead,
+// which do not print their progress.
 func Register(ctx context.Context, f billy.Filesystem, path string, recipients ...string) error {
-	gitageDir := dir(path)
-	info, err := f.Stat(gitageDir)
-	if (err != nil && os.IsNotExist(err)) || !info.IsDir() {
-		log.For(ctx).Printf("%s directory not found...\nAre you in a Gitage repository?\n", gitageDir)
-		return nil
-	}
-
-	recipientsFilepath := filepath.Join(gitageDir, "recipients")
-
-	info, err = f.Stat(recipientsFilepath)
-	if (err != nil && os.IsNotExist(err)) || info.IsDir() {
-		log.For(ctx).Printf("%s file not found...\nAre you in a Gitage repository?\n", gitageDir)
-		return nil
-	}
+	return RegisterGroup(ctx, f, path, "", recipients...)
+}
 
+// RegisterGroup is like Register, but it registers the recipients
+// in the given group (see Rules.Group), where the empty one is the
+// default group (the .gitage/recipients file). The group is created
+// if it does not exist yet.
+// - path MUST be an absolute path.
+//
+// Deprecated: use Open and Repository.RegisterGroup instead,
+// which do not print their progress.
+func RegisterGroup(ctx context.Context, f billy.Filesystem, path, group string, recipients ...string) error {
+	repo, err := Open(f, path)
 	if err != nil {
 		return err
 	}
 
 	log.For(ctx).Println("Registering recipients...")
 
-	contents, err := fs.Read(f, recipientsFilepath)
-	if err != nil {
+	if err := repo.RegisterGroup(ctx, group, recipients...); err != nil {
 		return err
 	}
 
-	var bytes []byte
+	log.For(ctx).Println("Recipients registered with success!")
+
+	return nil
+}
 
+// parseRecipientEntries parses the given entries of the
+// recipients file, and checks that their recipients are valid.
+func parseRecipientEntries(recipients ...string) ([]RecipientEntry, error) {
+	entries := make([]RecipientEntry, 0, len(recipients))
 	for _, r := range recipients {
-		if !strings.Contains(string(contents), r) {
-			bytes = append(bytes, []byte(r)...)
-			bytes = append(bytes, []byte("\n")...)
+		entry, err := ParseRecipientEntry(r)
+		if err == nil {
+			_, err = entry.Recipient()
 		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+		entries = append(entries, entry)
 	}
 
-	if len(bytes) > 0 {
-		if err := fs.Append(f, recipientsFilepath, recipientsBytes(recipients...)); err != nil {
+	return entries, nil
+}
+
+// addRecipients adds the given entries to the recipients of the given
+// group, of the repository at the given root, unless already there.
+// The group is created if it does not exist yet.
+func addRecipients(f billy.Filesystem, root, group string, entries ...RecipientEntry) error {
+	recipientsFilepath := groupRecipientsPath(root, group)
+
+	set := new(RecipientSet)
+	if _, err := f.Stat(recipientsFilepath); err == nil {
+		set, err = readRecipientSet(f, recipientsFilepath)
+		if err != nil {
 			return err
 		}
+	} else if !os.IsNotExist(err) {
+		return err
 	}
 
-	log.For(ctx).Println("Recipients registered with success!")
+	changed := false
+	for _, entry := range entries {
+		if set.Add(entry) {
+			changed = true
+		}
+	}
 
-	return nil
+	if !changed {
+		return nil
+	}
+
+	return fs.Create(f, recipientsFilepath, set.Bytes())
 }
@@ -0,0 +1,163 @@
+package gitage
+
+import (
+	"context"
+	"io"
+	stdfs "io/fs"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// RekeyAll re-encrypts all the encrypted files in the specified
+// path, recursively, to the recipients currently registered in
+// the repository, for the group each file belongs to (see
+// Rules.Group), so recipients unregistered can no longer
+// decrypt them, and the ones registered can, and returns
+// their paths, relative to the root of the repository.
+//
+// Files are decrypted with the given identities, and encrypted back
+// as they are decrypted, so their plain contents never touch the disk.
+//
+// Unlike DecryptAll, every encrypted file (with the .age extension)
+// is re-encrypted, even if it does not match the rules of the
+// repository anymore (see FileOrphaned). Otherwise, it skips the same
+// files and directories.
+//
+// The recipients each file is re-encrypted to are recorded in
+// the .gitage/manifest file, like EncryptAll does.
+//
+// Files are processed concurrently, as many at once as the context says
+// (see WithJobs). Any failure (e.g. a file that cannot be decrypted
+// with the given identities), or the cancellation of the context,
+// rolls back the whole operation (see Recover), so either all the
+// files are re-encrypted, or none is.
+func (r *Repository) RekeyAll(ctx context.Context, path string, identities ...age.Identity) ([]string, error) {
+	path, err := r.abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.rekeyAll(ctx, path, identities...)
+}
+
+// RekeyAll re-encrypts all the encrypted files in the specified path,
+// recursively, as Repository.RekeyAll does, within the Gitage repository
+// that contains the path.
+//
+// Arguments:
+// - path: must be an absolute path.
+func RekeyAll(ctx context.Context, f billy.Filesystem, path string, identities ...age.Identity) ([]string, error) {
+	r, err := Open(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.rekeyAll(ctx, path, identities...)
+}
+
+func (r *Repository) rekeyAll(ctx context.Context, path string, identities ...age.Identity) ([]string, error) {
+	f := r.f
+
+	// Files may be processed concurrently (see WithJobs).
+	if jobsFrom(ctx) > 1 {
+		f = fs.Synchronized(f)
+	}
+
+	skip, err := skipPolicy(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadRules(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := newRecipientsResolver(f, r.cfg, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := openJournal(ctx, f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ops   []op
+		paths []string
+
+		// The recipients of each file, resolved while walking,
+		// as files may be processed concurrently later on.
+		recipientsOf = make(map[string]fileRecipients)
+	)
+
+	err = fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories and non-encrypted files
+		if info.IsDir() || !strings.HasSuffix(path, r.cfg.Extension) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return err
+		}
+
+		// The group is the one of the plain file.
+		recipients, err := resolver.forFile(strings.TrimSuffix(path, r.cfg.Extension))
+		if err != nil {
+			return err
+		}
+
+		// Replaced in place.
+		ops = append(ops, newOp(path, path))
+		paths = append(paths, filepath.ToSlash(rel))
+		recipientsOf[path] = recipients
+
+		return nil
+	}, skip)
+	if err != nil {
+		return nil, j.abort(err)
+	}
+
+	err = j.run(ctx, ops, func(o op) error {
+		return rekeyOp(ctx, f, r.cfg, o, identities, recipientsOf[o.src].recipients)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make(map[string]string, len(ops))
+	for _, o := range ops {
+		fingerprints[o.dst] = recipientsOf[o.src].fingerprint
+	}
+
+	if err := recordRecipients(f, r.root, fingerprints); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// rekeyOp prepares the given operation, by decrypting the
+// encrypted file (src) and encrypting it back into the temporary
+// file (tmp), as a stream, so no plain contents are written.
+func rekeyOp(ctx context.Context, f billy.Filesystem, cfg *Config, o op, identities []age.Identity, recipients []age.Recipient) error {
+	return o.stream(f, func(dst io.Writer, src io.Reader) error {
+		r, err := decryptReader(src, identities...)
+		if err != nil {
+			return err
+		}
+
+		return encryptStream(ctx, dst, r, cfg.Armor, recipients...)
+	})
+}
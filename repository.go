@@ -0,0 +1,193 @@
+package gitage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// Repository is a Gitage repository, located once (see Open), which
+// operations are all relative to, so the .gitage directory is not
+// looked up again on every call, like the package-level functions do.
+//
+// Its methods never write anything but the files of the repository,
+// and report every failure as an error, so it can be embedded in
+// other programs. Paths given to them are either absolute, or relative
+// to the root of the repository, and must be within it.
+//
+// It is not safe for concurrent use.
+type Repository struct {
+	f    billy.Filesystem
+	root string
+	cfg  *Config
+}
+
+// Open opens the Gitage repository that contains the given path, which
+// is looked up by walking up the directory tree until a .gitage directory
+// is found, and loads its configuration (see LoadConfig).
+//
+// It returns ErrNotARepository if the path is not within any.
+//
+// Arguments:
+// - path: must be an absolute path.
+func Open(f billy.Filesystem, path string) (*Repository, error) {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig(f, root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{f: f, root: root, cfg: cfg}, nil
+}
+
+// InitRepository initializes a new Gitage repository at the given path,
+// by creating the .gitage directory, with the default configuration and
+// the given recipients, as entries of the recipients file (see
+// RecipientEntry), and a Git repository, unless there is one already.
+//
+// It fails if the .gitage directory already exists.
+//
+// Arguments:
+// - path: must be an absolute path.
+func InitRepository(_ context.Context, f billy.Filesystem, path string, recipients ...string) (*Repository, error) {
+	if err := initRepository(f, path, recipients...); err != nil {
+		return nil, err
+	}
+
+	return Open(f, path)
+}
+
+// repositoryFor returns the Gitage repository that contains the given
+// path or, as the package-level functions can also be used outside of
+// a repository, a detached one, with the default configuration and no
+// root, if the path is not within any.
+func repositoryFor(f billy.Filesystem, path string) (*Repository, error) {
+	cfg, err := configFor(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{f: f, root: cfg.root, cfg: cfg}, nil
+}
+
+// Root returns the path of the root of the repository,
+// the directory that contains the .gitage directory.
+func (r *Repository) Root() string {
+	return r.root
+}
+
+// Config returns the configuration of the repository,
+// as loaded when it was opened.
+func (r *Repository) Config() *Config {
+	return r.cfg
+}
+
+// Recipients returns the recipients registered in the given group
+// (see Rules.Group), where the empty one is the default group.
+func (r *Repository) Recipients(group string) (*RecipientSet, error) {
+	if len(group) > 0 {
+		if err := validateGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	return readRecipientSet(r.f, groupRecipientsPath(r.root, group))
+}
+
+// Groups returns the names of the groups of recipients (see
+// Rules.Group) that have a file in the .gitage/groups directory,
+// sorted by name, which excludes the default group.
+func (r *Repository) Groups() ([]string, error) {
+	infos, err := r.f.ReadDir(filepath.Join(dir(r.root), groupsDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var groups []string
+	for _, info := range infos {
+		if info.IsDir() || validateGroup(info.Name()) != nil {
+			continue
+		}
+		groups = append(groups, info.Name())
+	}
+
+	sort.Strings(groups)
+
+	return groups, nil
+}
+
+// Register registers the given recipients in the default group.
+// They are entries of the recipients file (see RecipientEntry),
+// so they can be labeled (e.g. age1... # Alice <alice@corp>).
+// Those already registered are not registered twice, but labeled
+// if they were not.
+func (r *Repository) Register(ctx context.Context, recipients ...string) error {
+	return r.RegisterGroup(ctx, "", recipients...)
+}
+
+// RegisterGroup is like Register, but it registers the recipients
+// in the given group (see Rules.Group), where the empty one is the
+// default group. The group is created if it does not exist yet.
+func (r *Repository) RegisterGroup(_ context.Context, group string, recipients ...string) error {
+	if len(group) > 0 {
+		if err := validateGroup(group); err != nil {
+			return err
+		}
+	}
+
+	entries, err := parseRecipientEntries(recipients...)
+	if err != nil {
+		return err
+	}
+
+	return addRecipients(r.f, r.root, group, entries...)
+}
+
+// Unregister unregisters the given recipients from the default group.
+// They are either keys or labels (e.g. alice, or alice@corp), which
+// match any entry with that label, name or email (see RecipientEntry).
+func (r *Repository) Unregister(ctx context.Context, recipients ...string) error {
+	return r.UnregisterGroup(ctx, "", recipients...)
+}
+
+// UnregisterGroup is like Unregister, but it unregisters the recipients
+// from the given group (see Rules.Group), which must exist, where the
+// empty one is the default group.
+func (r *Repository) UnregisterGroup(_ context.Context, group string, recipients ...string) error {
+	if len(group) > 0 {
+		if err := checkGroup(r.f, r.root, group); err != nil {
+			return err
+		}
+	}
+
+	return removeRecipients(r.f, r.root, group, recipients...)
+}
+
+// abs returns the given path as an absolute one, resolved
+// against the root of the repository if relative (the root
+// itself, if empty), as long as it is within the repository.
+func (r *Repository) abs(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.root, path)
+	}
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRepository, path)
+	}
+
+	return path, nil
+}
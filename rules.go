@@ -0,0 +1,271 @@
+package gitage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/danwakefield/fnmatch"
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// AttributesFile is the name of the file, placed at the root of
+// the repository, that defines which files get encrypted, and
+// to which group of recipients, with a syntax similar to the one
+// of .gitattributes files:
+//
+//	# Encrypt everything under secrets/ and any .env file...
+//	secrets/**  encrypt
+//	*.env       encrypt
+//	# ...except for the example ones.
+//	*.env.example  -encrypt
+//	# Production secrets are only for the ops group.
+//	prod/**  group=ops
+const AttributesFile = ".gitageattributes"
+
+// Rules decide which files of a repository are encrypted, based on
+// the include and exclude patterns defined in the .gitage/config file
+// and the .gitageattributes file.
+//
+// Patterns follow fnmatch semantics, with a few additions borrowed from
+// .gitignore files:
+//   - Patterns without a slash are matched against the file name.
+//   - Patterns with a slash are matched against the path relative to the
+//     repository root, where a ** segment matches any number of directories.
+//   - Patterns with a trailing slash match everything below a directory.
+//
+// The last matching rule wins, with rules evaluated in this order: include
+// patterns from the config, the .gitageattributes file and exclude patterns
+// from the config (so excludes always take precedence).
+//
+// When there is no include rule at all, every file is encrypted.
+//
+// Rules also decide the group of recipients each file is encrypted
+// to (see Group), as set by the group=<name> attribute of the last
+// matching pattern of the .gitageattributes file that sets it.
+type Rules struct {
+	root   string
+	rules  []rule
+	groups []groupRule
+}
+
+type rule struct {
+	pattern string
+	encrypt bool
+}
+
+type groupRule struct {
+	pattern string
+	group   string
+}
+
+// LoadRules loads the encryption rules of the Gitage repository
+// that contains the given path, which is looked up by walking up
+// the directory tree until a .gitage directory is found.
+//
+// Arguments:
+// - path: must be an absolute path.
+func LoadRules(f billy.Filesystem, path string) (*Rules, error) {
+	root, err := FindRoot(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig(f, root)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadRules(f, cfg)
+}
+
+func loadRules(f billy.Filesystem, cfg *Config) (*Rules, error) {
+	r := &Rules{root: cfg.root}
+
+	for _, pattern := range cfg.Include {
+		r.rules = append(r.rules, rule{pattern: pattern, encrypt: true})
+	}
+
+	// The configuration may not come from a repository,
+	// in which case there is no attributes file to read.
+	if len(cfg.root) > 0 {
+		attrs, groups, err := readAttributes(f, filepath.Join(cfg.root, AttributesFile))
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, attrs...)
+		r.groups = groups
+	}
+
+	for _, pattern := range cfg.Exclude {
+		r.rules = append(r.rules, rule{pattern: pattern, encrypt: false})
+	}
+
+	return r, nil
+}
+
+func readAttributes(f billy.Filesystem, path string) ([]rule, []groupRule, error) {
+	contents, err := fs.Read(f, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var (
+		rules  []rule
+		groups []groupRule
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, nil, fmt.Errorf("%s: line %d: missing attributes for pattern %q", path, n, fields[0])
+		}
+
+		pattern := fields[0]
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "encrypt":
+				rules = append(rules, rule{pattern: pattern, encrypt: true})
+			case attr == "-encrypt":
+				rules = append(rules, rule{pattern: pattern, encrypt: false})
+			case strings.HasPrefix(attr, "group="):
+				group := strings.TrimPrefix(attr, "group=")
+				if err := validateGroup(group); err != nil {
+					return nil, nil, fmt.Errorf("%s: line %d: %w", path, n, err)
+				}
+				groups = append(groups, groupRule{pattern: pattern, group: group})
+			case attr == "-group":
+				groups = append(groups, groupRule{pattern: pattern})
+			default:
+				return nil, nil, fmt.Errorf("%s: line %d: unknown attribute %q", path, n, attr)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return rules, groups, nil
+}
+
+// Match reports whether the (plain) file at the given
+// path must be encrypted, according to the rules.
+//
+// Arguments:
+// - path: must be an absolute path.
+func (r *Rules) Match(path string) bool {
+	rel := r.rel(path)
+
+	match := !r.hasInclude()
+
+	for _, rule := range r.rules {
+		if matchPattern(rule.pattern, rel) {
+			match = rule.encrypt
+		}
+	}
+
+	return match
+}
+
+// Group returns the group of recipients the (plain) file at the
+// given path is encrypted to, according to the rules, which is
+// empty for the default group (the .gitage/recipients file).
+//
+// A -group attribute sets the default group back.
+//
+// Arguments:
+// - path: must be an absolute path.
+func (r *Rules) Group(path string) string {
+	rel := r.rel(path)
+
+	group := ""
+	for _, rule := range r.groups {
+		if matchPattern(rule.pattern, rel) {
+			group = rule.group
+		}
+	}
+
+	return group
+}
+
+// rel returns the given path relative to the repository
+// root, with forward slashes, as patterns are written.
+func (r *Rules) rel(path string) string {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || len(r.root) == 0 {
+		rel = path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// hasInclude reports whether there is any include rule,
+// as otherwise every file is encrypted.
+func (r *Rules) hasInclude() bool {
+	for _, rule := range r.rules {
+		if rule.encrypt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern reports whether the given pattern matches the given
+// path, relative to the repository root and with forward slashes.
+func matchPattern(pattern, rel string) bool {
+	dir := strings.HasSuffix(pattern, "/")
+	if !dir && !strings.Contains(pattern, "/") {
+		return fnmatch.Match(pattern, path.Base(rel), 0)
+	}
+
+	pattern = strings.Trim(pattern, "/")
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"), dir)
+}
+
+// matchSegments matches the path segments against the pattern segments,
+// one by one, where a ** segment matches zero or more directories (or
+// everything below, when it is the last one). When dir is true, the
+// pattern also matches everything below the directories it matches.
+func matchSegments(pattern, rel []string, dir bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(rel) > 0
+			}
+
+			for i := 0; i <= len(rel); i++ {
+				if matchSegments(pattern[1:], rel[i:], dir) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(rel) == 0 || !fnmatch.Match(pattern[0], rel[0], fnmatch.FNM_PATHNAME) {
+			return false
+		}
+
+		pattern, rel = pattern[1:], rel[1:]
+	}
+
+	return len(rel) == 0 || dir
+}
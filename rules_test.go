@@ -0,0 +1,53 @@
+package gitage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		pattern string
+		rel     string
+		match   bool
+	}{
+		// Patterns without a slash match the file name.
+		{pattern: "*.env", rel: "prod.env", match: true},
+		{pattern: "*.env", rel: "config/prod.env", match: true},
+		{pattern: "*.env", rel: "config/prod.json", match: false},
+
+		// Patterns with a slash match the path from the root.
+		{pattern: "config/*.env", rel: "config/prod.env", match: true},
+		{pattern: "/config/*.env", rel: "config/prod.env", match: true},
+		{pattern: "config/*.env", rel: "app/config/prod.env", match: false},
+		{pattern: "config/*.env", rel: "config/prod/db.env", match: false},
+
+		// A ** segment matches zero or more directories.
+		{pattern: "**/*.env", rel: "prod.env", match: true},
+		{pattern: "**/*.env", rel: "config/prod/db.env", match: true},
+		{pattern: "secrets/**/*.json", rel: "secrets/db.json", match: true},
+		{pattern: "secrets/**/*.json", rel: "secrets/prod/eu/db.json", match: true},
+		{pattern: "secrets/**/*.json", rel: "secrets/prod/db.env", match: false},
+		{pattern: "secrets/**", rel: "secrets/prod/db.json", match: true},
+		{pattern: "secrets/**", rel: "secrets", match: false},
+
+		// A single * never matches a slash, even next to a **.
+		{pattern: "a/*/c/**", rel: "a/b/c/d", match: true},
+		{pattern: "a/*/c/**", rel: "a/x/y/c/d", match: false},
+		{pattern: "config/*/**.json", rel: "config/a/c.json", match: true},
+		{pattern: "config/*/**.json", rel: "config/a/b/c.json", match: false},
+
+		// Patterns with a trailing slash match everything below.
+		{pattern: "secrets/", rel: "secrets", match: true},
+		{pattern: "secrets/", rel: "secrets/prod/db.json", match: true},
+		{pattern: "secrets/", rel: "app/secrets/db.json", match: false},
+		{pattern: "**/secrets/", rel: "app/secrets/db.json", match: true},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.match, matchPattern(tc.pattern, tc.rel), "pattern %q, path %q", tc.pattern, tc.rel)
+	}
+}
@@ -0,0 +1,85 @@
+package gitage
+
+import (
+	"errors"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+)
+
+// DefaultScryptWorkFactor is the default work factor used to
+// encrypt files with a passphrase, which is the one age uses.
+const DefaultScryptWorkFactor = 18
+
+// maxScryptWorkFactor is the highest work factor age supports.
+const maxScryptWorkFactor = 30
+
+// ErrScryptNotAlone is returned when files are meant to be encrypted with
+// a passphrase (see PassphraseRecipient) and other recipients at once,
+// which age forbids, as it would make the passphrase pointless.
+var ErrScryptNotAlone = errors.New("a passphrase cannot be combined with other recipients")
+
+// PassphraseRecipient returns a recipient that encrypts files with the
+// given passphrase (scrypt), with the work factor configured in the
+// Gitage repository that contains the given path, if any.
+//
+// It must be the only recipient files are encrypted to (see ErrScryptNotAlone).
+//
+// Arguments:
+// - path: must be an absolute path.
+func PassphraseRecipient(f billy.Filesystem, path string, passphrase string) (age.Recipient, error) {
+	cfg, err := configFor(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	r.SetWorkFactor(cfg.ScryptWorkFactor)
+
+	return r, nil
+}
+
+// PassphraseIdentity returns an identity that decrypts files encrypted
+// with the given passphrase (see PassphraseRecipient), accepting work
+// factors up to the one configured in the Gitage repository that contains
+// the given path, if higher than the one age accepts by default.
+//
+// Arguments:
+// - path: must be an absolute path.
+func PassphraseIdentity(f billy.Filesystem, path string, passphrase string) (age.Identity, error) {
+	cfg, err := configFor(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// age accepts work factors up to 22 by default.
+	if cfg.ScryptWorkFactor > 22 {
+		i.SetMaxWorkFactor(cfg.ScryptWorkFactor)
+	}
+
+	return i, nil
+}
+
+// checkRecipients checks that the given recipients can be used together.
+func checkRecipients(recipients ...age.Recipient) error {
+	if len(recipients) < 2 {
+		return nil
+	}
+
+	for _, r := range recipients {
+		if _, ok := r.(*age.ScryptRecipient); ok {
+			return ErrScryptNotAlone
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package gitage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// metadataFiles are the names of the files that hold
+// Git and Gitage metadata, which are never encrypted.
+var metadataFiles = map[string]bool{
+	".gitignore":     true,
+	".gitattributes": true,
+	".gitmodules":    true,
+	AttributesFile:   true,
+}
+
+// skipPolicy returns the policy used to walk the files of a
+// repository, which skips the Git directory (or the .git file of
+// worktrees and submodules), the Gitage directory, the Git and
+// Gitage metadata files, the temporary files written while
+// encrypting or decrypting files, and (unless disabled in the
+// configuration) the files ignored by Git (.gitignore).
+func skipPolicy(f billy.Filesystem, cfg *Config) (fs.SkipPolicy, error) {
+	var ignored gitignore.Matcher
+
+	if len(cfg.root) > 0 && cfg.Gitignore {
+		root, err := f.Chroot(cfg.root)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns, err := gitignore.ReadPatterns(root, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		ignored = gitignore.NewMatcher(patterns)
+	}
+
+	return func(path string, info os.FileInfo) bool {
+		name := info.Name()
+
+		if name == git.GitDirName || (info.IsDir() && name == dirName) {
+			return true
+		}
+
+		if !info.IsDir() && (metadataFiles[name] || strings.HasSuffix(name, tmpExt)) {
+			return true
+		}
+
+		if ignored == nil {
+			return false
+		}
+
+		rel, err := filepath.Rel(cfg.root, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return false
+		}
+
+		return ignored.Match(strings.Split(filepath.ToSlash(rel), "/"), info.IsDir())
+	}, nil
+}
@@ -0,0 +1,286 @@
+package gitage
+
+import (
+	"context"
+	"errors"
+	stdfs "io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// FileState describes whether a file that is meant
+// to be encrypted, according to the rules of the
+// repository (see Rules), is actually encrypted.
+type FileState string
+
+const (
+	// FileEncrypted is the state of a file that is encrypted.
+	FileEncrypted FileState = "encrypted"
+
+	// FilePlaintext is the state of a file that is meant
+	// to be encrypted, but that is not.
+	FilePlaintext FileState = "plaintext"
+
+	// FileOrphaned is the state of an encrypted file that
+	// is not meant to be encrypted (e.g. after a rule was
+	// removed), so it is never decrypted by DecryptAll.
+	FileOrphaned FileState = "orphaned"
+
+	// FileConflict is the state of a file that is meant to be
+	// encrypted, and that is present both plain and encrypted
+	// (e.g. foo and foo.age), so it cannot be (de)crypted.
+	FileConflict FileState = "conflict"
+
+	// FileFiltered is the state of a file that is meant to be
+	// encrypted, and that is in plaintext, but that Git encrypts
+	// itself, through the filter driver (see Install), so it is
+	// never stored in plaintext, unless it was staged before.
+	FileFiltered FileState = "filtered"
+)
+
+// Exposed reports whether a file in the given
+// state holds its contents in plaintext, while
+// it is meant to be encrypted.
+func (s FileState) Exposed() bool {
+	return s == FilePlaintext || s == FileConflict
+}
+
+// FileStatus is the status of a single file.
+type FileStatus struct {
+	// Path is the path of the file, relative to the
+	// root of the repository. It is the plain one for
+	// files in conflict, and the encrypted one otherwise.
+	Path string `json:"path"`
+
+	// State is the state of the file.
+	State FileState `json:"state"`
+
+	// Group is the group of recipients the file is (or is
+	// meant to be) encrypted to (see Rules.Group), which is
+	// empty for the default group.
+	Group string `json:"group,omitempty"`
+}
+
+// Status walks the specified path, recursively, and reports
+// the state of every file that is meant to be encrypted,
+// according to the same rules used by EncryptAll and DecryptAll,
+// and skipping the same files and directories, as well as the
+// state of any encrypted file that is not meant to be.
+func (r *Repository) Status(ctx context.Context, path string) ([]FileStatus, error) {
+	path, err := r.abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.status(ctx, path)
+}
+
+// Status reports the state of the files in the specified path,
+// recursively, as Repository.Status does, within the Gitage
+// repository that contains the path, if any, or with the default
+// configuration otherwise, where paths are relative to the given one.
+//
+// Arguments:
+// - path: must be an absolute path.
+func Status(ctx context.Context, f billy.Filesystem, path string) ([]FileStatus, error) {
+	r, err := repositoryFor(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.status(ctx, path)
+}
+
+func (r *Repository) status(ctx context.Context, path string) ([]FileStatus, error) {
+	f := r.f
+
+	rules, err := loadRules(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	skip, err := skipPolicy(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	root := r.root
+	if len(root) == 0 {
+		root = path
+	}
+
+	filter, err := loadFilterState(f, r.cfg, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	exists := make(map[string]bool)
+
+	err = fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories
+		if info.IsDir() {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		paths = append(paths, path)
+		exists[path] = true
+
+		return nil
+	}, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []FileStatus
+
+	for _, path := range paths {
+		var state FileState
+
+		plainPath := strings.TrimSuffix(path, r.cfg.Extension)
+
+		switch {
+		case strings.HasSuffix(path, r.cfg.Extension):
+
+			switch {
+			case !rules.Match(plainPath):
+				state = FileOrphaned
+			case exists[plainPath]:
+				// Reported with the plain file.
+				continue
+			default:
+				state = FileEncrypted
+			}
+
+		case rules.Match(path):
+			state = FilePlaintext
+			if exists[path+r.cfg.Extension] {
+				state = FileConflict
+				break
+			}
+
+			filtered, err := filter.filtered(root, path)
+			if err != nil {
+				return nil, err
+			}
+
+			if filtered {
+				state = FileFiltered
+			}
+
+		default:
+			// Skip files not meant to be encrypted
+			continue
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, FileStatus{
+			Path:  filepath.ToSlash(rel),
+			State: state,
+			Group: rules.Group(plainPath),
+		})
+	}
+
+	return statuses, nil
+}
+
+// filterState tells whether the plain files of a repository are
+// encrypted by Git itself, through the filter driver (see Install).
+type filterState struct {
+	attributes gitattributes.Matcher
+	index      *index.Index
+	checker    *checker
+}
+
+// loadFilterState loads the Git attributes and the index of the
+// Git repository at the root of the given repository, if any. It
+// returns a nil state, which filters no file, if there is none.
+func loadFilterState(f billy.Filesystem, cfg *Config, rules *Rules) (*filterState, error) {
+	if len(cfg.root) == 0 {
+		return nil, nil
+	}
+
+	repo, err := openGitRepository(f, cfg.root)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := f.Chroot(cfg.root)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := gitattributes.ReadPatterns(wt, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	return &filterState{
+		attributes: gitattributes.NewMatcher(patterns),
+		index:      idx,
+		checker:    &checker{cfg: cfg, rules: rules, repo: repo, encrypted: make(map[plumbing.Hash]bool)},
+	}, nil
+}
+
+// filtered reports whether the plain file at the given path is
+// encrypted by the filter driver, which is the case when the
+// filter applies to it, and it is either not staged yet, or
+// staged encrypted, as Git only cleans files when staging them.
+func (s *filterState) filtered(root, path string) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	attrs, _ := s.attributes.Match(strings.Split(rel, "/"), []string{"filter"})
+	if attr, ok := attrs["filter"]; !ok || !attr.IsValueSet() || attr.Value() != FilterDriver {
+		return false, nil
+	}
+
+	e, err := s.index.Entry(rel)
+	if errors.Is(err, index.ErrEntryNotFound) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	exposed, err := s.checker.exposed(rel, e.Hash)
+
+	return !exposed, err
+}
@@ -1,11 +1,9 @@
 package gitage
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/go-git/go-billy/v5"
 
@@ -15,59 +13,71 @@ import (
 
 // Unregister docs (TODO)
 // - path MUST be an absolute path.
+// - recipients are either keys or labels (e.g. alice, or
+// alice@corp), which match any entry of the recipients
+// file with that label, name or email (see RecipientEntry).
+//
+// Deprecated: use Open and Repository.Unregister instead,
+// which do not print their progress.
 func Unregister(ctx context.Context, f billy.Filesystem, path string, recipients ...string) error {
-	gitageDir := dir(path)
-	info, err := f.Stat(gitageDir)
-	if (err != nil && os.IsNotExist(err)) || !info.IsDir() {
-		log.For(ctx).Printf("%s directory not found...\nAre you in a Gitage repository?\n", gitageDir)
-		return nil
-	}
-
-	recipientsFilepath := filepath.Join(gitageDir, "recipients")
-
-	info, err = f.Stat(recipientsFilepath)
-	if (err != nil && os.IsNotExist(err)) || info.IsDir() {
-		log.For(ctx).Printf("%s file not found...\nAre you in a Gitage repository?\n", gitageDir)
-		return nil
-	}
+	return UnregisterGroup(ctx, f, path, "", recipients...)
+}
 
+// UnregisterGroup is like Unregister, but it unregisters the recipients
+// from the given group (see Rules.Group), where the empty one is the
+// default group (the .gitage/recipients file).
+// - path MUST be an absolute path.
+//
+// Deprecated: use Open and Repository.UnregisterGroup instead,
+// which do not print their progress.
+func UnregisterGroup(ctx context.Context, f billy.Filesystem, path, group string, recipients ...string) error {
+	repo, err := Open(f, path)
 	if err != nil {
 		return err
 	}
 
 	log.For(ctx).Println("Unregistering recipients...")
 
-	contents, err := fs.Read(f, recipientsFilepath)
-	if err != nil {
+	if err := repo.UnregisterGroup(ctx, group, recipients...); err != nil {
 		return err
 	}
 
-	var result []byte
+	log.For(ctx).Println("Recipients unregistered with success!")
 
-	fileScanner := bufio.NewScanner(bytes.NewBuffer(contents))
-	for fileScanner.Scan() {
-		next := fileScanner.Text()
-		if !present(next, recipients...) {
-			result = append(result, []byte(next)...)
-			result = append(result, []byte("\n")...)
-		}
-	}
+	return nil
+}
 
-	if err := fs.Create(f, recipientsFilepath, result); err != nil {
+// checkGroup checks that the given group (see Rules.Group)
+// exists in the repository at the given root.
+func checkGroup(f billy.Filesystem, root, group string) error {
+	if err := validateGroup(group); err != nil {
 		return err
 	}
 
-	log.For(ctx).Println("Recipients unregistered with success!")
+	if _, err := f.Stat(groupRecipientsPath(root, group)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("group %q not found", group)
+		}
+		return err
+	}
 
 	return nil
 }
 
-func present(r string, recipients ...string) bool {
-	for _, recipient := range recipients {
-		if r == recipient {
-			return true
-		}
+// removeRecipients removes the given recipients, either keys or
+// labels, from the recipients of the given group, of the repository
+// at the given root.
+func removeRecipients(f billy.Filesystem, root, group string, recipients ...string) error {
+	recipientsFilepath := groupRecipientsPath(root, group)
+
+	set, err := readRecipientSet(f, recipientsFilepath)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		set.Remove(r)
 	}
 
-	return false
+	return fs.Create(f, recipientsFilepath, set.Bytes())
 }
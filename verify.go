@@ -0,0 +1,208 @@
+package gitage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdfs "io/fs"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-billy/v5"
+
+	"github.com/joanlopez/gitage/internal/fs"
+)
+
+// FileCheck is the result of verifying a single encrypted file (see Verify).
+type FileCheck struct {
+	// Path is the path of the encrypted file,
+	// relative to the root of the repository.
+	Path string `json:"path"`
+
+	// Group is the group of recipients the file is meant to
+	// be encrypted to (see Rules.Group), which is empty for
+	// the default group.
+	Group string `json:"group,omitempty"`
+
+	// Problems are the problems found in the file (e.g. it is
+	// encrypted to stale recipients, or it cannot be decrypted).
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Verify checks every encrypted file in the specified path,
+// recursively, without writing anything, and reports, for each
+// one, the problems found, if any:
+//   - Files not encrypted to the recipients currently registered for
+//     them, as recorded in the .gitage/manifest file (see EncryptAll),
+//     like files encrypted before the recipients changed and not
+//     re-encrypted since (see RekeyAll), or files not recorded at all.
+//   - Files with a corrupt age header, or payload.
+//   - Files that cannot be decrypted with the given identities, which
+//     is only checked when some identities are given.
+//
+// It skips the same files and directories RekeyAll does.
+func (r *Repository) Verify(ctx context.Context, path string, identities ...age.Identity) ([]FileCheck, error) {
+	path, err := r.abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.verify(ctx, path, identities...)
+}
+
+// Verify checks every encrypted file in the specified path, recursively,
+// as Repository.Verify does, within the Gitage repository that contains
+// the path.
+//
+// Arguments:
+// - path: must be an absolute path.
+func Verify(ctx context.Context, f billy.Filesystem, path string, identities ...age.Identity) ([]FileCheck, error) {
+	r, err := Open(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.verify(ctx, path, identities...)
+}
+
+func (r *Repository) verify(ctx context.Context, path string, identities ...age.Identity) ([]FileCheck, error) {
+	f := r.f
+
+	rules, err := loadRules(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	skip, err := skipPolicy(f, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := newRecipientsResolver(f, r.cfg, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := readManifest(f, r.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []FileCheck
+
+	err = fs.Walk(f, path, func(path string, info stdfs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories and non-encrypted files
+		if info.IsDir() || !strings.HasSuffix(path, r.cfg.Extension) {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		check := FileCheck{
+			Path:  relSlash(r.root, path),
+			Group: rules.Group(strings.TrimSuffix(path, r.cfg.Extension)),
+		}
+
+		problem, err := checkManifest(f, r.root, m, resolver, check.Group, path)
+		if err != nil {
+			return err
+		}
+		if len(problem) > 0 {
+			check.Problems = append(check.Problems, problem)
+		}
+
+		problem, err = checkDecryption(ctx, f, path, identities...)
+		if err != nil {
+			return err
+		}
+		if len(problem) > 0 {
+			check.Problems = append(check.Problems, problem)
+		}
+
+		checks = append(checks, check)
+
+		return nil
+	}, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+// checkManifest checks that the encrypted file at the given path is
+// encrypted to the recipients registered in the given group, according
+// to the manifest, and describes the problem found otherwise, if any.
+func checkManifest(f billy.Filesystem, root string, m *manifest, resolver *recipientsResolver, group, path string) (string, error) {
+	resolved, err := resolver.forGroup(group)
+	if err != nil {
+		return fmt.Sprintf("cannot resolve its recipients: %s", err), nil
+	}
+
+	fingerprint, current, err := m.lookup(f, root, path)
+	switch {
+	case err != nil:
+		return "", err
+	case len(fingerprint) == 0:
+		return "recipients unknown (not recorded in the manifest)", nil
+	case !current:
+		return "recipients unknown (changed since recorded in the manifest)", nil
+	case fingerprint != resolved.fingerprint:
+		return "encrypted to stale recipients (see rekey)", nil
+	}
+
+	return "", nil
+}
+
+// checkDecryption checks that the encrypted file at the given path can
+// be decrypted with the given identities, in full, or only that its age
+// header can be parsed, if there are none, and describes the problem
+// found otherwise, if any. Nothing decrypted is written anywhere.
+func checkDecryption(ctx context.Context, f billy.Filesystem, path string, identities ...age.Identity) (string, error) {
+	file, err := f.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	headerOnly := len(identities) == 0
+	if headerOnly {
+		identities = []age.Identity{noIdentity{}}
+	}
+
+	r, err := age.Decrypt(dearmor(file), identities...)
+
+	var noMatch *age.NoIdentityMatchError
+	switch {
+	case errors.As(err, &noMatch) && headerOnly:
+		return "", nil
+	case errors.As(err, &noMatch):
+		return "cannot be decrypted with the given identities", nil
+	case err != nil:
+		return fmt.Sprintf("corrupt: %s", err), nil
+	}
+
+	if _, err := io.Copy(io.Discard, ctxReader{ctx: ctx, r: r}); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return fmt.Sprintf("corrupt: %s", err), nil
+	}
+
+	return "", nil
+}
+
+// noIdentity is an identity that matches no recipient, so
+// decrypting with it only parses the header of the file.
+type noIdentity struct{}
+
+func (noIdentity) Unwrap([]*age.Stanza) ([]byte, error) {
+	return nil, age.ErrIncorrectIdentity
+}